@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"sysreboot/reboot"
+)
+
+// atJob describes an action submitted to the at daemon with --use-at.
+type atJob struct {
+	Job    string    `json:"job"`    // Job number reported by at.
+	Action string    `json:"action"` // Action the job performs.
+	Time   time.Time `json:"time"`   // Moment the job runs.
+}
+
+// atSkipFlags lists the flags that only describe the schedule handed over to
+// at, or were already dealt with before handing it over, and are therefore
+// not passed on to the job.
+var atSkipFlags = []int{cancelWindowIndex, confirmIndex, confirmPhraseIndex, daemonIndex, dateIndex, delayIndex, dryRunIndex, jitterIndex, minDelayIndex, timeIndex, useAtIndex, waitIndex, warnAtIndex}
+
+// atJobPattern finds the job number in the "job 12 at ..." line at prints.
+var atJobPattern = regexp.MustCompile(`\bjob (\d+)\b`)
+
+func atAvailable() bool {
+	// Report whether jobs can be submitted to at(1) on this system.
+	if runtime.GOOS == "windows" {
+		return false
+	}
+	_, err := exec.LookPath("at")
+	return err == nil
+}
+
+func getAtJobFilePath(job string) string {
+	// Each submitted job has its own record next to the log file, like the state files.
+	return filepath.Join(getLogFileDirectory(), fmt.Sprintf("%s-at-%s.job", appName, job))
+}
+
+// handleAtSchedule submits the action to the at daemon for the moment it is
+// due and returns without waiting, so that no process has to stay alive.
+func handleAtSchedule(dateStr string, timeStr string, delay time.Duration, action string) error {
+	target := clock.Now().Add(delay)
+	if timeStr != "" {
+		at, err := reboot.ParseTime(dateStr, timeStr, scheduleNow())
+		if err != nil {
+			return usageError{err}
+		}
+		target = at
+	}
+	target = target.Add(jitterOffset(action))
+	// The job runs without a wait, so a poweroff or halt gets its --min-delay
+	// here, as with shutdown(8). --grace is left to the job, which observes it
+	// after at starts it, just as it follows an in-process wait.
+	until := target.Sub(clock.Now())
+	if wait := enforceMinDelay(action, until); wait != until {
+		target = clock.Now().Add(wait)
+	}
+
+	// The action happens without us, so confirm before handing it over.
+	if confirmationRequired() && !confirmAction(context.Background(), getConfirmOptions()) {
+		printLine("Action cancelled.")
+		logger.Info("Action cancelled by user.")
+		return errCancelled
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot determine the sysreboot executable: %v", err)
+	}
+	args := append([]string{exe, "--action", action}, forwardedFlags(atSkipFlags)...)
+	return scheduleViaAt(action, target, args, *(appFlags[dryRunIndex].value.(*bool)))
+}
+
+func scheduleViaAt(action string, target time.Time, args []string, dryRun bool) error {
+	// Pipe the command line into at for the target time, rounded up to the
+	// minute at works in, and remember the job so that --cancel can remove it.
+	target = target.Local()
+	if rounded := target.Truncate(time.Minute); rounded.Before(target) {
+		target = rounded.Add(time.Minute)
+	}
+	cmd := exec.Command("at", "-t", target.Format("200601021504"))
+	command := shellJoin(args)
+	if dryRun {
+		line := fmt.Sprintf("Dry run (%s): would submit to %s: %s", runtime.GOOS, shellJoin(cmd.Args), command)
+		logger.Info(line)
+		printLine(line)
+		return nil
+	}
+
+	var output bytes.Buffer
+	cmd.Stdin = strings.NewReader(command + "\n")
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %v: %s", shellJoin(cmd.Args), err, strings.TrimSpace(output.String()))
+	}
+	match := atJobPattern.FindStringSubmatch(output.String())
+	if match == nil {
+		return fmt.Errorf("cannot find the job number in the output of at: %s", strings.TrimSpace(output.String()))
+	}
+
+	data, err := json.Marshal(atJob{Job: match[1], Action: action, Time: target})
+	if err == nil {
+		err = os.WriteFile(getAtJobFilePath(match[1]), data, 0644)
+	}
+	if err != nil {
+		logger.Errorf("Failed to record at job %s: %v\n", match[1], err)
+	}
+
+	logger.Infof("%s handed over to at as job %s for %s.\n", action, match[1], target.Format("2006-01-02 15:04"))
+	logAudit(action, "scheduled for "+target.Format(time.RFC3339))
+	reportScheduled(action, target)
+	printf("%s scheduled with at (job %s) at %s; cancel it with --cancel.\n", action, match[1], formatScheduleTime(target, clock.Now()))
+	return nil
+}
+
+func pendingAtJobs() ([]atJob, error) {
+	// Load the recorded at jobs that are still queued, pruning the records of
+	// jobs that have run or were removed with atrm.
+	paths, err := filepath.Glob(filepath.Join(getLogFileDirectory(), appName+"-at-*.job"))
+	if err != nil || len(paths) == 0 {
+		return nil, err
+	}
+	output, err := exec.Command("atq").Output()
+	if err != nil {
+		return nil, fmt.Errorf("atq failed: %v", err)
+	}
+	queued := make(map[string]bool)
+	for _, line := range strings.Split(string(output), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			queued[fields[0]] = true
+		}
+	}
+
+	var jobs []atJob
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var job atJob
+		if err := json.Unmarshal(data, &job); err != nil || !queued[job.Job] {
+			logVerbose("Removing record of at job that is no longer queued: " + path)
+			removeAtJob(path)
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func removeAtJob(path string) {
+	// Remove an at job record, ignoring the case where it is already gone.
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Errorf("Failed to remove at job record: %v\n", err)
+	}
+}
+
+func cancelAtJobs() (int, []string) {
+	// Remove every recorded at job from the queue, returning how many were
+	// cancelled and a description of each failure.
+	jobs, err := pendingAtJobs()
+	if err != nil {
+		return 0, []string{err.Error()}
+	}
+	cancelled := 0
+	var failures []string
+	for _, job := range jobs {
+		if output, err := exec.Command("atrm", job.Job).CombinedOutput(); err != nil {
+			failures = append(failures, fmt.Sprintf("%s (at job %s): %v: %s", job.Action, job.Job, err, strings.TrimSpace(string(output))))
+			continue
+		}
+		removeAtJob(getAtJobFilePath(job.Job))
+		logger.Infof("Cancelled %s scheduled at %s (at job %s).\n", job.Action, job.Time.Format("15:04"), job.Job)
+		printf("Cancelled %s scheduled at %s (at job %s).\n", job.Action, job.Time.Format("15:04"), job.Job)
+		cancelled++
+	}
+	return cancelled, failures
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// pendingBoot is written to sysreboot-boot.json right before a reboot whose
+// completion is to be reported to a webhook, and read back by --report-boot
+// once the machine is up again:
+//
+//	{"action":"reboot","reason":"Kernel update","user":"alice","webhook":"https://...","requested_at":"2026-10-14T23:00:00+02:00"}
+type pendingBoot struct {
+	Action      string    `json:"action"`           // Action that was performed.
+	Reason      string    `json:"reason,omitempty"` // Value of --reason, if any.
+	User        string    `json:"user"`             // User who invoked sysreboot.
+	Webhook     string    `json:"webhook"`          // URL the completion is reported to.
+	RequestedAt time.Time `json:"requested_at"`     // Moment the system command was run.
+}
+
+// bootReport is the JSON body posted by --report-boot once the machine is back:
+//
+//	{"hostname":"web-07","event":"completed","action":"reboot","reason":"Kernel update","requested_at":"...","booted_at":"...","timestamp":"..."}
+type bootReport struct {
+	Hostname    string `json:"hostname"`
+	Event       string `json:"event"` // Always "completed".
+	Action      string `json:"action"`
+	Reason      string `json:"reason,omitempty"`
+	RequestedAt string `json:"requested_at"`
+	BootedAt    string `json:"booted_at"`
+	Timestamp   string `json:"timestamp"`
+}
+
+func getPendingBootFilePath() string {
+	// The record lives next to the log file, like the record of the last action.
+	return filepath.Join(getLogFileDirectory(), appName+"-boot.json")
+}
+
+func recordPendingBoot(action string, reason string) {
+	// Remember a reboot for --report-boot when a webhook is to hear about it.
+	// Actions that do not restart the machine are never reported.
+	url := *(appFlags[webhookIndex].value.(*string))
+	if url == "" || action != "reboot" {
+		return
+	}
+	data, err := json.Marshal(pendingBoot{Action: action, Reason: reason, User: invokingUser(), Webhook: url, RequestedAt: time.Now()})
+	if err == nil {
+		err = os.WriteFile(getPendingBootFilePath(), data, 0644)
+	}
+	if err != nil {
+		logger.Errorf("Failed to record pending reboot: %v\n", err)
+	}
+}
+
+func clearPendingBoot() {
+	// Forget the pending reboot once it has been reported or failed to happen.
+	if err := os.Remove(getPendingBootFilePath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Errorf("Failed to remove pending reboot record: %v\n", err)
+	}
+}
+
+// reportBoot confirms to the webhook that the reboot recorded by
+// recordPendingBoot completed, if the machine has booted since. It is meant to
+// run at boot, from an @reboot crontab entry or a systemd unit. The record is
+// kept when the webhook cannot be reached, so that a later run can try again.
+func reportBoot() error {
+	data, err := os.ReadFile(getPendingBootFilePath())
+	if errors.Is(err, os.ErrNotExist) {
+		printLine("No pending reboot to report.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var pending pendingBoot
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return fmt.Errorf("invalid pending reboot file %s: %v", getPendingBootFilePath(), err)
+	}
+
+	up, err := uptime()
+	if err != nil {
+		return fmt.Errorf("cannot tell whether the machine rebooted: %v", err)
+	}
+	bootedAt := time.Now().Add(-up)
+	if !bootedAt.After(pending.RequestedAt) {
+		printf("The %s requested at %s has not happened yet.\n", pending.Action, pending.RequestedAt.Format("2006-01-02 15:04:05"))
+		return nil
+	}
+
+	url := *(appFlags[webhookIndex].value.(*string))
+	if url == "" {
+		url = pending.Webhook
+	}
+	report := bootReport{
+		Hostname:    getHostname(),
+		Event:       "completed",
+		Action:      pending.Action,
+		Reason:      pending.Reason,
+		RequestedAt: pending.RequestedAt.Format(time.RFC3339),
+		BootedAt:    bootedAt.Format(time.RFC3339),
+		Timestamp:   time.Now().Format(time.RFC3339),
+	}
+	if err := postWebhook(url, report, *(appFlags[dryRunIndex].value.(*bool))); err != nil {
+		return err
+	}
+	if !*(appFlags[dryRunIndex].value.(*bool)) {
+		clearPendingBoot()
+		logger.Infof("Reported completed %s requested at %s to %s.\n", pending.Action, report.RequestedAt, url)
+		printf("Reported completed %s to %s.\n", pending.Action, url)
+	}
+	return nil
+}
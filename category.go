@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// categoryPolicies maps each --category to the flag values it seeds, keyed by
+// flag index. Flags given on the command line keep their value; the policy
+// takes precedence over the config file and the built-in defaults.
+var categoryPolicies = map[string]map[int]string{
+	// Act as soon as possible: no prompt, no last-chance window, no grace period.
+	"emergency": {
+		cancelWindowIndex: "0",
+		confirmIndex:      "false",
+		graceIndex:        "0",
+		minDelayIndex:     "0",
+		warnAtIndex:       "1m",
+	},
+	// Unattended upkeep: leave users time to save their work.
+	"routine": {
+		confirmIndex:  "false",
+		graceIndex:    "120",
+		minDelayIndex: "60",
+		warnAtIndex:   "10m,5m,1m",
+	},
+	// Planned work with an operator at hand: ask first and warn well ahead.
+	"maintenance": {
+		confirmIndex:  "true",
+		minDelayIndex: "300",
+		warnAtIndex:   "1h,30m,10m,1m",
+	},
+}
+
+// categorySeeded records the long names of the flags set by the category policy.
+var categorySeeded = make(map[string]bool)
+
+func applyCategoryPolicy() error {
+	// Seed the flags of the policy named by --category that were not given on
+	// the command line, and log what was applied.
+	category := *(appFlags[categoryIndex].value.(*string))
+	if category == "" {
+		return nil
+	}
+	policy, ok := categoryPolicies[category]
+	if !ok {
+		names := make([]string, 0, len(categoryPolicies))
+		for name := range categoryPolicies {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return usageError{fmt.Errorf("invalid --category %q (expected one of %s)", category, strings.Join(names, ", "))}
+	}
+
+	var applied []string
+	for index, raw := range policy {
+		fd := appFlags[index]
+		if flagGiven(fd) {
+			continue
+		}
+		value, err := parseFlagValue(fd, raw)
+		if err != nil {
+			return fmt.Errorf("invalid %s policy value for --%s: %q", category, fd.longName, raw)
+		}
+		assignFlagValue(fd, value)
+		categorySeeded[fd.longName] = true
+		applied = append(applied, fmt.Sprintf("--%s=%s", fd.longName, raw))
+	}
+	sort.Strings(applied)
+	logger.Infof("Applied %s policy: %s\n", category, strings.Join(applied, " "))
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"time"
+
+	"sysreboot/reboot"
+)
+
+// Clock tells the time and waits, so that scheduling can be exercised with a
+// fake clock instead of real time.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a pending call started by Clock.AfterFunc.
+type Timer interface {
+	Stop() bool
+}
+
+// systemClock is the Clock backed by the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+var (
+	// clock is used for scheduling and timeouts; replaceable for testing.
+	clock Clock = systemClock{}
+
+	// systemCommandRunner runs the command performing the action and the sync
+	// before it; replaceable for testing with a fake that records the commands
+	// instead of starting them.
+	systemCommandRunner reboot.Runner = reboot.ExecRunner{}
+)
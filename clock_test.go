@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"math/rand"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock whose time only moves when told to. After advances the
+// time by the wait itself, so loops waiting on it finish right away, and
+// AfterFunc calls are made as the time passes their due moment.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []*fakeTimer
+	waits   []time.Duration // Every wait passed to After, in order.
+	onAfter func()          // Called by After once the time has moved on, if set.
+}
+
+// fakeTimer is a call pending on a fakeClock.
+type fakeTimer struct {
+	clock   *fakeClock
+	at      time.Time
+	f       func()
+	stopped bool
+}
+
+func newFakeClock(t *testing.T, now time.Time) *fakeClock {
+	// Install a fake clock set to now for the rest of the test.
+	t.Helper()
+	c := &fakeClock{now: now}
+	saved := clock
+	clock = c
+	t.Cleanup(func() { clock = saved })
+	return c
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	c.waits = append(c.waits, d)
+	c.mu.Unlock()
+	c.Advance(d)
+	if c.onAfter != nil {
+		c.onAfter()
+	}
+	ch := make(chan time.Time, 1)
+	ch <- c.Now()
+	return ch
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	timer := &fakeTimer{clock: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, timer)
+	return timer
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	// Move the time on by d and make the calls that have come due, earliest
+	// first.
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due, pending []*fakeTimer
+	for _, timer := range c.timers {
+		switch {
+		case timer.stopped:
+		case !timer.at.After(c.now):
+			due = append(due, timer)
+		default:
+			pending = append(pending, timer)
+		}
+	}
+	c.timers = pending
+	c.mu.Unlock()
+
+	sort.SliceStable(due, func(i, j int) bool { return due[i].at.Before(due[j].at) })
+	for _, timer := range due {
+		timer.f()
+	}
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	for i, timer := range t.clock.timers {
+		if timer == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			t.stopped = true
+			return true
+		}
+	}
+	return false
+}
+
+func recordBroadcasts(t *testing.T) *[]string {
+	// Replace the message channels with one that records every message sent.
+	t.Helper()
+	var sent []string
+	saved := messageChannels
+	messageChannels = append(messageChannels[:0:0], saved[0])
+	messageChannels[0].flag = wallIndex
+	messageChannels[0].send = func(message string, dryRun bool) { sent = append(sent, message) }
+	t.Cleanup(func() { messageChannels = saved })
+	setFlag(t, wallIndex, "true")
+	return &sent
+}
+
+func resetArmedWarnings(t *testing.T) {
+	// Stop the warnings a test armed once it is over.
+	t.Cleanup(func() { armWarnings(time.Time{}, 0, nil, nil) })
+}
+
+func TestArmWarningsFiresAtCheckpoints(t *testing.T) {
+	c := newFakeClock(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	sent := recordBroadcasts(t)
+	resetArmedWarnings(t)
+
+	armWarnings(c.Now().Add(10*time.Minute), 10*time.Minute, []time.Duration{5 * time.Minute, time.Minute}, []string{"first in %s", "last in %s"})
+	c.Advance(4 * time.Minute)
+	if len(*sent) != 0 {
+		t.Fatalf("sent %q before the first checkpoint", *sent)
+	}
+	c.Advance(time.Minute)
+	c.Advance(4 * time.Minute)
+	if want := []string{"first in 5m0s", "last in 1m0s"}; !reflect.DeepEqual(*sent, want) {
+		t.Errorf("sent %q, want %q", *sent, want)
+	}
+}
+
+func TestArmWarningsReplacesPendingTimers(t *testing.T) {
+	c := newFakeClock(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	sent := recordBroadcasts(t)
+	resetArmedWarnings(t)
+
+	deadline := c.Now().Add(10 * time.Minute)
+	armWarnings(deadline, 10*time.Minute, []time.Duration{5 * time.Minute}, []string{"old %s"})
+	armWarnings(deadline, 10*time.Minute, []time.Duration{5 * time.Minute}, []string{"new %s"})
+	c.Advance(10 * time.Minute)
+	if want := []string{"new 5m0s"}; !reflect.DeepEqual(*sent, want) {
+		t.Errorf("sent %q, want %q", *sent, want)
+	}
+}
+
+func TestJitterOffsetStaysWithinBound(t *testing.T) {
+	setFlag(t, jitterIndex, "30s")
+	saved := jitterRand
+	jitterRand = rand.New(rand.NewSource(1))
+	t.Cleanup(func() { jitterRand = saved })
+
+	for i := 0; i < 100; i++ {
+		offset := jitterOffset("reboot")
+		if offset < 0 || offset > 30*time.Second || offset%time.Second != 0 {
+			t.Fatalf("jitterOffset = %s, want whole seconds between 0 and 30s", offset)
+		}
+	}
+}
+
+func TestRecordLastActionStoresGivenTime(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", dir)
+	t.Setenv("APPDATA", dir)
+	at := time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC)
+
+	recordLastAction("reboot", "kernel update", at)
+	data, err := os.ReadFile(getLastActionFilePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got lastAction
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Time.Equal(at) || got.Action != "reboot" || got.Reason != "kernel update" {
+		t.Errorf("recorded %+v, want reboot at %s for kernel update", got, at)
+	}
+}
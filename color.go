@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"time"
+)
+
+// ANSI escape sequences used to highlight interactive output.
+const (
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorRed    = "\x1b[31m"
+	colorYellow = "\x1b[33m"
+)
+
+// urgentCountdown is the remaining time below which the countdown turns red.
+const urgentCountdown = time.Minute
+
+func colorEnabled() bool {
+	// Use color only on a terminal, following the NO_COLOR convention
+	// (https://no-color.org) and --no-color. Piped output, logs and JSON stay
+	// plain. The classic Windows console prints escape sequences literally.
+	if *(appFlags[noColorIndex].value.(*bool)) || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return runtime.GOOS != "windows" && isTerminal(os.Stdout) && !jsonOutput()
+}
+
+func colorize(color string, text string) string {
+	// Wrap text in the color escape sequence when color is enabled.
+	if !colorEnabled() {
+		return text
+	}
+	return color + text + colorReset
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"sysreboot/reboot"
+)
+
+// configSetting is a validated value from the config file waiting to be applied.
+type configSetting struct {
+	fd    flagData
+	value interface{}
+}
+
+// commandOverrides maps an action to the command configured to perform it in
+// place of the built-in OS default, set with "<action>_command" in the config file.
+var commandOverrides = make(map[string][]string)
+
+// commandOverrideSuffix marks config keys that override the command of an action.
+const commandOverrideSuffix = "_command"
+
+// confirmWording holds the text of the confirmation prompt and the answers
+// that accept it, which the config file can translate or rephrase.
+type confirmWording struct {
+	prompt       string   // Question asked without --confirm-phrase; "confirm_prompt".
+	phrasePrompt string   // Question asked with --confirm-phrase, where %s stands for the phrase; "confirm_phrase_prompt".
+	responses    []string // Answers accepted in any case; "confirm_responses", separated by commas.
+}
+
+// defaultConfirmWording is the built-in English wording.
+var defaultConfirmWording = confirmWording{
+	prompt:       "Are you sure you want to proceed with the action? (y/n)",
+	phrasePrompt: "Type %s to proceed with the action:",
+	responses:    []string{"y", "yes"},
+}
+
+// confirmText is the wording in effect, set from the config file by loadConfig.
+var confirmText = defaultConfirmWording
+
+func getConfigFilePath() string {
+	// Use the per-user configuration directory, falling back to the log directory.
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return filepath.Join(getLogFileDirectory(), appName+".conf")
+	}
+	return filepath.Join(configDir, appName, "config")
+}
+
+// loadConfig seeds flag values from the config file. The file holds one
+// "name = value" pair per line, where name is the long form of a flag or
+// <action>_command, such as reboot_command; blank lines and lines starting
+// with '#' are ignored. Flags given on the command line
+// always take precedence. A missing file is not an error. A malformed file is
+// ignored as a whole so the built-in defaults stay in effect, and the problem is
+// returned for the caller to report once logging is set up.
+func loadConfig() error {
+	settings, commands, wording, err := readConfigFile(getConfigFilePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	for _, setting := range settings {
+		if explicit[setting.fd.longName] || explicit[setting.fd.shortName] {
+			continue
+		}
+		assignFlagValue(setting.fd, setting.value)
+	}
+	commandOverrides = commands
+	confirmText = wording
+	return nil
+}
+
+func readConfigFile(path string) ([]configSetting, map[string][]string, confirmWording, error) {
+	// Parse and validate every line of the config file without applying anything.
+	wording := defaultConfirmWording
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, wording, err
+	}
+	defer file.Close()
+
+	var settings []configSetting
+	commands := make(map[string][]string)
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, raw, found := strings.Cut(line, "=")
+		if !found {
+			return nil, nil, wording, fmt.Errorf("line %d: expected name = value", lineNum)
+		}
+		key = strings.TrimSpace(key)
+		raw = strings.TrimSpace(raw)
+		if unquoted, err := strconv.Unquote(raw); err == nil {
+			raw = unquoted
+		}
+
+		if action, ok := strings.CutSuffix(key, commandOverrideSuffix); ok && reboot.IsAction(action) {
+			argv, err := splitCommandLine(raw)
+			if err != nil {
+				return nil, nil, wording, fmt.Errorf("line %d: invalid command for %s: %v", lineNum, key, err)
+			}
+			commands[action] = argv
+			continue
+		}
+
+		switch key {
+		case "confirm_prompt":
+			if raw == "" {
+				return nil, nil, wording, fmt.Errorf("line %d: %s is empty", lineNum, key)
+			}
+			wording.prompt = raw
+			continue
+		case "confirm_phrase_prompt":
+			if strings.Count(raw, "%s") != 1 {
+				return nil, nil, wording, fmt.Errorf("line %d: %s must contain %%s exactly once, for the phrase", lineNum, key)
+			}
+			wording.phrasePrompt = raw
+			continue
+		case "confirm_responses":
+			var responses []string
+			for _, response := range strings.Split(raw, ",") {
+				if response = strings.TrimSpace(response); response != "" {
+					responses = append(responses, response)
+				}
+			}
+			if len(responses) == 0 {
+				return nil, nil, wording, fmt.Errorf("line %d: %s lists no answers", lineNum, key)
+			}
+			wording.responses = responses
+			continue
+		}
+
+		fd, ok := lookupFlag(key)
+		if !ok {
+			return nil, nil, wording, fmt.Errorf("line %d: unknown option %q", lineNum, key)
+		}
+		value, err := parseFlagValue(fd, raw)
+		if err != nil {
+			return nil, nil, wording, fmt.Errorf("line %d: invalid value for %s: %q", lineNum, key, raw)
+		}
+		settings = append(settings, configSetting{fd: fd, value: value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, wording, err
+	}
+	return settings, commands, wording, nil
+}
+
+// splitCommandLine splits a command line into arguments the way a POSIX shell
+// would, without expanding anything: whitespace separates arguments, single
+// quotes preserve everything literally, and inside double quotes or unquoted
+// text a backslash escapes the next character.
+func splitCommandLine(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inArg = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if escaped {
+		return nil, errors.New("trailing backslash")
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+	return args, nil
+}
+
+func lookupFlag(longName string) (flagData, bool) {
+	// Find a flag definition by its long name.
+	for _, fd := range appFlags {
+		if fd.longName == longName {
+			return fd, true
+		}
+	}
+	return flagData{}, false
+}
+
+func parseFlagValue(fd flagData, raw string) (interface{}, error) {
+	// Convert a raw string to the type stored by the flag.
+	switch fd.value.(type) {
+	case *bool:
+		return strconv.ParseBool(raw)
+	case *int:
+		return strconv.Atoi(raw)
+	default:
+		return raw, nil
+	}
+}
+
+// dumpConfig writes a config file template with one commented-out line per
+// option, showing its built-in default, and an example command override. The
+// flags selecting a mode of their own, such as --list, are left out.
+func dumpConfig(w io.Writer) {
+	skip := make(map[int]bool)
+	for _, index := range directiveModeFlags {
+		skip[index] = true
+	}
+
+	fmt.Fprintf(w, "# %s config file, usually %s.\n", appName, getConfigFilePath())
+	fmt.Fprintf(w, "# One \"name = value\" pair per line; options given on the command line take\n")
+	fmt.Fprintf(w, "# precedence. Uncomment a line to change the default.\n")
+	for index, fd := range appFlags {
+		if skip[index] {
+			continue
+		}
+		value := ""
+		switch v := fd.defaultVal.(type) {
+		case string:
+			value = strconv.Quote(v)
+		case nil:
+			value = `""`
+		default:
+			value = fmt.Sprint(v)
+		}
+		fmt.Fprintf(w, "\n# %s\n# %s = %s\n", fd.usage, fd.longName, value)
+	}
+	fmt.Fprintf(w, "\n# Command to perform an action with instead of the OS default, for any of\n# %s.\n", strings.Join(reboot.Actions, ", "))
+	fmt.Fprintf(w, "# reboot%s = \"systemctl reboot --force\"\n", commandOverrideSuffix)
+	fmt.Fprintf(w, "\n# Wording of the confirmation prompt and the answers that accept it.\n")
+	fmt.Fprintf(w, "# confirm_prompt = %q\n", defaultConfirmWording.prompt)
+	fmt.Fprintf(w, "# confirm_phrase_prompt = %q\n", defaultConfirmWording.phrasePrompt)
+	fmt.Fprintf(w, "# confirm_responses = %q\n", strings.Join(defaultConfirmWording.responses, ", "))
+}
+
+func assignFlagValue(fd flagData, value interface{}) {
+	// Store a value previously returned by parseFlagValue into the flag.
+	switch v := fd.value.(type) {
+	case *bool:
+		*v = value.(bool)
+	case *int:
+		*v = value.(int)
+	case *string:
+		*v = value.(string)
+	case *stringList:
+		*v = append(*v, value.(string))
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// daemonEnvVar marks the detached copy started by --daemon, so that it waits
+// for the action itself instead of detaching again.
+const daemonEnvVar = "SYSREBOOT_DAEMON"
+
+func runningAsDaemon() bool {
+	// Report whether this process is the detached copy started by startDaemon.
+	return os.Getenv(daemonEnvVar) == "1"
+}
+
+func getPIDFilePath() string {
+	// The PID file of the daemon lives next to the log file, like the state files.
+	return filepath.Join(getLogFileDirectory(), appName+".pid")
+}
+
+// startDaemon runs this executable again with the same arguments, detached from
+// the terminal and the login session (see detachedProcAttr), and records the
+// PID of the copy. The copy logs to the configured destination as usual; its
+// standard streams are connected to the null device. The working directory is
+// kept so that relative paths on the command line still resolve.
+func startDaemon(action string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot determine the sysreboot executable: %v", err)
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), daemonEnvVar+"=1")
+	cmd.SysProcAttr = detachedProcAttr()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting the %s daemon: %v", action, err)
+	}
+	pid := cmd.Process.Pid
+	cmd.Process.Release()
+
+	if err := os.WriteFile(getPIDFilePath(), []byte(strconv.Itoa(pid)+"\n"), 0644); err != nil {
+		logger.Errorf("Failed to write PID file: %v\n", err)
+	}
+	logger.Infof("Started %s daemon for %s (PID %d).\n", appName, action, pid)
+	printf("%s will wait in the background (PID %d); use --list or --cancel to manage it.\n", action, pid)
+	return nil
+}
+
+func removePIDFile() {
+	// Remove the PID file once the daemon stops waiting, unless a newer daemon
+	// has replaced it in the meantime.
+	data, err := os.ReadFile(getPIDFilePath())
+	if err != nil || strings.TrimSpace(string(data)) != strconv.Itoa(os.Getpid()) {
+		return
+	}
+	if err := os.Remove(getPIDFilePath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Errorf("Failed to remove PID file: %v\n", err)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"sysreboot/reboot"
+)
+
+// A directive describes one action on a single line:
+//
+//	directive = action [when] {key "=" value}
+//	action    = "reboot" | "poweroff" | "shutdown" | "halt" | "suspend" | "hibernate"
+//	when      = "now" | "+" duration | HH:MM
+//
+// Each key is the long name of a flag, such as reason, message or date, and
+// values may be quoted as in the config file. Blank lines and lines starting
+// with # are ignored.
+
+// directiveModeFlags lists the flags that select a mode of their own rather
+// than describe an action, and therefore cannot appear in a directive.
+var directiveModeFlags = []int{cancelIndex, checkIndex, dumpConfigIndex, explainIndex, helpIndex, lastIndex, listIndex, repeatIndex, reportBootIndex, stdinIndex, versionIndex}
+
+// directiveScheduleFlags lists the flags describing when the action runs,
+// which each directive sets for itself.
+var directiveScheduleFlags = []int{dateIndex, delayIndex, timeIndex, waitIndex}
+
+func parseDirective(line string) ([]string, error) {
+	// Translate a directive into the command-line arguments it stands for.
+	words, err := splitCommandLine(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	action, err := reboot.ParseAction(words[0])
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"--action", action}
+	words = words[1:]
+
+	if len(words) > 0 && !strings.Contains(words[0], "=") {
+		switch when := words[0]; {
+		case when == "now":
+		case strings.HasPrefix(when, "+") || strings.Contains(when, ":"):
+			args = append(args, "--time", when)
+		default:
+			return nil, fmt.Errorf("invalid time %q (expected now, +duration or HH:MM)", when)
+		}
+		words = words[1:]
+	}
+
+	for _, word := range words {
+		key, value, found := strings.Cut(word, "=")
+		if !found {
+			return nil, fmt.Errorf("expected key=value, got %q", word)
+		}
+		if !directiveKeyAllowed(key) {
+			return nil, fmt.Errorf("unknown key %q", key)
+		}
+		args = append(args, "--"+key+"="+value)
+	}
+	return args, nil
+}
+
+func directiveKeyAllowed(key string) bool {
+	// Accept the long name of any flag that is neither an action nor a mode.
+	for _, index := range append(append([]int(nil), directiveModeFlags...), actionFlagIndexes...) {
+		if appFlags[index].longName == key {
+			return false
+		}
+	}
+	for _, fd := range appFlags {
+		if fd.longName == key {
+			return true
+		}
+	}
+	return false
+}
+
+func runDirectives(r io.Reader) error {
+	// Run sysreboot once per directive, in order, with the other flags given on
+	// the command line. A malformed or failing directive is reported and the
+	// remaining ones still run.
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot determine the sysreboot executable: %v", err)
+	}
+	common := forwardedFlags(append(append([]int(nil), directiveModeFlags...), directiveScheduleFlags...))
+
+	scanner := bufio.NewScanner(r)
+	lineNumber, failures := 0, 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		args, err := parseDirective(line)
+		if err == nil {
+			logger.Infof("Running directive %d: %s\n", lineNumber, line)
+			printf("Directive %d: %s\n", lineNumber, line)
+			cmd := exec.Command(exe, append(append([]string(nil), common...), args...)...)
+			cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+			err = cmd.Run()
+		}
+		if err != nil {
+			failures++
+			logger.Errorf("Directive %d failed: %v\n", lineNumber, err)
+			fmt.Fprintf(os.Stderr, "Error: directive %d: %v\n", lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading directives: %v", err)
+	}
+	if failures > 0 {
+		return fmt.Errorf("%d directive(s) failed", failures)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDirective(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"reboot", []string{"--action", "reboot"}},
+		{"reboot now", []string{"--action", "reboot"}},
+		{"shutdown +30m", []string{"--action", "poweroff", "--time", "+30m"}},
+		{"poweroff 23:00 reason=maintenance", []string{"--action", "poweroff", "--time", "23:00", "--reason=maintenance"}},
+		{`reboot 02:00 date=2024-05-01 message="Back in 5 minutes"`, []string{"--action", "reboot", "--time", "02:00", "--date=2024-05-01", "--message=Back in 5 minutes"}},
+		{"halt reason='a=b'", []string{"--action", "halt", "--reason=a=b"}},
+	}
+	for _, tt := range tests {
+		got, err := parseDirective(tt.line)
+		if err != nil {
+			t.Errorf("parseDirective(%q): %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseDirective(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseDirectiveRejectsMalformedLines(t *testing.T) {
+	for _, line := range []string{
+		"restart",               // unknown action
+		"reboot tomorrow",       // invalid time
+		"reboot now reason",     // missing =
+		"reboot now colour=red", // unknown key
+		"reboot now list=true",  // mode flag
+		"reboot now halt=true",  // action flag
+		`reboot message="open`,  // unterminated quote
+	} {
+		if got, err := parseDirective(line); err == nil {
+			t.Errorf("parseDirective(%q) = %q, want an error", line, got)
+		}
+	}
+}
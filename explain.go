@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"sysreboot/reboot"
+)
+
+// explainPlan describes in plain English what sysreboot would do with the
+// options given, one sentence per line, without doing any of it. Options that
+// do not parse are left for the normal run to report.
+func explainPlan(action string) []string {
+	var lines []string
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+
+	now := scheduleNow()
+	delay := plannedWait(action, now)
+	at := now.Add(delay)
+	machine := fmt.Sprintf("this machine (%s) will %s", getHostname(), strings.ToUpper(action))
+
+	if repeat := *(appFlags[repeatIndex].value.(*string)); repeat != "" {
+		if schedule, err := parseRecurringSchedule(repeat, *(appFlags[dateIndex].value.(*string)), *(appFlags[timeIndex].value.(*string)), now); err == nil {
+			when := schedule.String()
+			add("%s, %s; the schedule is installed now and sysreboot exits.", strings.ToUpper(when[:1])+when[1:], machine)
+		}
+	} else if delay > 0 {
+		add("At %s (in %s), %s.", describeDay(at, now), humanizeDuration(delay), machine)
+	} else {
+		add("Right away, %s.", machine)
+	}
+	if jitter := *(appFlags[jitterIndex].value.(*string)); jitter != "" {
+		add("A random offset of up to %s is added to that time.", jitter)
+	}
+	if *(appFlags[daemonIndex].value.(*bool)) {
+		add("sysreboot waits in the background, so closing this terminal does not stop it.")
+	} else if *(appFlags[useSystemdShutdownIndex].value.(*bool)) && delay > 0 && systemdAvailable() && systemdInProcessOption(action) == "" {
+		add("The wait is handed over to systemd's shutdown command and sysreboot exits.")
+	} else if *(appFlags[useAtIndex].value.(*bool)) && delay > 0 && atAvailable() {
+		add("The wait is handed over to the at daemon and sysreboot exits.")
+	}
+
+	if *(appFlags[ifRequiredIndex].value.(*bool)) {
+		add("It only happens if the system reports that a reboot is required.")
+	}
+	if *(appFlags[ifIdleIndex].value.(*bool)) {
+		add("It only happens if nobody is logged in.")
+	}
+	if inhibitorsApply(action) {
+		add("It is refused while an application holds a systemd inhibitor lock against shutdown.")
+	}
+	if minUptime := *(appFlags[maxUptimeIndex].value.(*string)); minUptime != "" {
+		add("It only happens if the machine has been up for at least %s.", minUptime)
+	}
+	if maxLoad := *(appFlags[maxLoadIndex].value.(*string)); maxLoad != "" {
+		add("It only happens if the 1-minute load average is at most %s.", maxLoad)
+	}
+	if minFree := getFlagInt(minFreeMemIndex); minFree > 0 {
+		add("It only happens if at least %d MB of memory are available.", minFree)
+	}
+
+	if message := composeMessage(); message != "" {
+		users := "All logged-in users"
+		if notifyUsers := *(appFlags[notifyUserIndex].value.(*stringList)); len(notifyUsers) > 0 && *(appFlags[wallIndex].value.(*bool)) {
+			users = joinWords(notifyUsers)
+		}
+		var channels []string
+		if *(appFlags[wallIndex].value.(*bool)) {
+			channels = append(channels, "on their terminals")
+		}
+		if *(appFlags[notifyIndex].value.(*bool)) {
+			channels = append(channels, "with a desktop notification")
+		}
+		if len(channels) == 0 {
+			add("The message is not delivered because both --wall and --notify are off.")
+		} else if times := explainWarningTimes(at, delay); len(times) > 0 {
+			add("%s will be warned %s at %s, and once more when it happens.", users, strings.Join(channels, " and "), joinWords(times))
+		} else {
+			add("%s will be warned %s when it happens.", users, strings.Join(channels, " and "))
+		}
+		if messages := composeMessages(); len(messages) > 1 && len(channels) > 0 {
+			add("The %d messages are sent in turn, one per warning, and the last one is reused for the rest.", len(messages))
+		}
+	} else {
+		add("Users are not warned, since no --message was given.")
+	}
+	if grace := time.Duration(getFlagInt(graceIndex)) * time.Second; grace > 0 {
+		add("Then a grace period of %s gives applications time to save their work, followed by a final %s countdown.", grace, finalCountdown)
+	}
+
+	if confirmationRequired() {
+		opts := getConfirmOptions()
+		answer := confirmText.responses[0]
+		when := "right before it happens"
+		if *(appFlags[confirmWhenIndex].value.(*string)) == confirmAtStart && delay > 0 {
+			when = "before the wait starts"
+		}
+		if opts.phrase != "" {
+			answer = fmt.Sprintf("%q", opts.phrase)
+		}
+		if opts.timeout > 0 {
+			outcome := "aborts"
+			if opts.proceedOnTimeout {
+				outcome = "proceeds"
+			}
+			add("You will be asked to confirm %s by typing %s, with a %s timeout after which the action %s.", when, answer, opts.timeout, outcome)
+		} else {
+			add("You will be asked to confirm %s by typing %s, with no timeout.", when, answer)
+		}
+	}
+	if hooks := *(appFlags[preHookIndex].value.(*stringList)); len(hooks) > 0 {
+		add("Before it, these hooks run in order: %s.", joinWords(hooks))
+	}
+	if url := *(appFlags[webhookIndex].value.(*string)); url != "" {
+		add("A notification is sent to %s.", url)
+	}
+	if window := getFlagInt(cancelWindowIndex); window > 0 {
+		add("You can still abort by pressing Enter during the last %ds.", window)
+	}
+	if *(appFlags[syncIndex].value.(*bool)) {
+		add("File system buffers are flushed to disk first.")
+	}
+
+	if argv, _, err := systemCommand(action); err == nil && argv != nil {
+		add("The command run is: %s", shellJoin(argv))
+	}
+	if reason := *(appFlags[reasonIndex].value.(*string)); reason != "" {
+		add("The reason recorded is %q.", reason)
+	}
+	if *(appFlags[dryRunIndex].value.(*bool)) {
+		add("This is a dry run: the commands are printed instead of run.")
+	}
+	return lines
+}
+
+func plannedWait(action string, now time.Time) time.Duration {
+	// Work out how long after now the action is due from --time, --date,
+	// --delay, --wait and --min-delay, leaving out the random --jitter.
+	delay := plannedDelay()
+	if timeStr := *(appFlags[timeIndex].value.(*string)); timeStr != "" {
+		// Measure from the same moment as the rest of the plan.
+		if target, err := reboot.ParseTime(*(appFlags[dateIndex].value.(*string)), timeStr, now); err == nil {
+			delay = target.Sub(now)
+		}
+	}
+	if action == "poweroff" || action == "halt" {
+		if minDelay := time.Duration(getFlagInt(minDelayIndex)) * time.Second; delay < minDelay {
+			delay = minDelay
+		}
+	}
+	return delay
+}
+
+func explainWarningTimes(at time.Time, delay time.Duration) []string {
+	// List the times of day at which the repeated warnings go out, earliest first.
+	checkpoints := warningCheckpoints
+	if warnAt := *(appFlags[warnAtIndex].value.(*string)); warnAt != "" {
+		if custom, err := parseWarnAt(warnAt); err == nil {
+			checkpoints = custom
+		}
+	}
+	sorted := append([]time.Duration(nil), checkpoints...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+
+	var times []string
+	for _, checkpoint := range sorted {
+		if checkpoint < delay {
+			times = append(times, clockTime(at.Add(-checkpoint)))
+		}
+	}
+	return times
+}
+
+func describeDay(at time.Time, now time.Time) string {
+	// Name the moment as "23:00 today", "02:00 tomorrow" or with its date.
+	y, m, d := now.Date()
+	switch ay, am, ad := at.Date(); {
+	case ay == y && am == m && ad == d:
+		return clockTime(at) + " today"
+	case at.Format("2006-01-02") == time.Date(y, m, d+1, 0, 0, 0, 0, now.Location()).Format("2006-01-02"):
+		return clockTime(at) + " tomorrow"
+	}
+	return clockTime(at) + at.Format(" on Monday, 2 January 2006")
+}
+
+func clockTime(t time.Time) string {
+	// Format a time of day, with seconds only when it is not on the minute.
+	if t.Second() != 0 {
+		return t.Format("15:04:05")
+	}
+	return t.Format("15:04")
+}
+
+func joinWords(words []string) string {
+	// Join words as in "a, b, and c".
+	switch len(words) {
+	case 0:
+		return ""
+	case 1:
+		return words[0]
+	case 2:
+		return words[0] + " and " + words[1]
+	}
+	return strings.Join(words[:len(words)-1], ", ") + ", and " + words[len(words)-1]
+}
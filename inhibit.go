@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+func inhibitorsApply(action string) bool {
+	// Report whether systemd inhibitor locks are checked before the action:
+	// only on Linux, only for the actions that shut the machine down, and not
+	// with --ignore-inhibitors or --force.
+	switch action {
+	case "reboot", "poweroff", "halt":
+	default:
+		return false
+	}
+	return runtime.GOOS == "linux" && !*(appFlags[ignoreInhibitorsIndex].value.(*bool)) && !*(appFlags[forceIndex].value.(*bool))
+}
+
+// activeInhibitors asks logind over D-Bus for the inhibitor locks that block
+// shutdown, such as one taken by "systemd-inhibit --what=shutdown", and
+// describes each holder as "who (why)". Delay locks are left out, since they
+// only hold the shutdown back for a few seconds.
+func activeInhibitors() ([]string, error) {
+	output, err := exec.Command("busctl", "--json=short", "call", "org.freedesktop.login1", "/org/freedesktop/login1", "org.freedesktop.login1.Manager", "ListInhibitors").Output()
+	if err != nil {
+		return nil, fmt.Errorf("listing inhibitors: %v", err)
+	}
+	return parseInhibitors(output)
+}
+
+func parseInhibitors(output []byte) ([]string, error) {
+	// busctl prints the a(ssssuu) reply, whose entries are what, who, why, mode,
+	// uid and pid, as {"type":"a(ssssuu)","data":[[["shutdown:sleep","who","why","block",0,1]]]}.
+	var reply struct {
+		Data [][][]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(output, &reply); err != nil {
+		return nil, fmt.Errorf("unexpected busctl output: %v", err)
+	}
+	if len(reply.Data) != 1 {
+		return nil, errors.New("unexpected busctl output: no inhibitor list")
+	}
+
+	var holders []string
+	for _, entry := range reply.Data[0] {
+		if len(entry) < 4 {
+			continue
+		}
+		what, _ := entry[0].(string)
+		who, _ := entry[1].(string)
+		why, _ := entry[2].(string)
+		mode, _ := entry[3].(string)
+		if mode != "block" || !strings.Contains(":"+what+":", ":shutdown:") {
+			continue
+		}
+		holders = append(holders, fmt.Sprintf("%s (%s)", who, why))
+	}
+	return holders, nil
+}
+
+func checkInhibitors(action string) error {
+	// Refuse the action while an application holds a lock blocking shutdown.
+	// Without logind the check is skipped, since nothing can hold such a lock.
+	if !inhibitorsApply(action) {
+		return nil
+	}
+	holders, err := activeInhibitors()
+	if err != nil {
+		logVerbose(fmt.Sprintf("Not checking inhibitor locks: %v", err))
+		return nil
+	}
+	if len(holders) > 0 {
+		return fmt.Errorf("%s blocked by inhibitor locks held by %s; release them, or use --ignore-inhibitors or --force", action, strings.Join(holders, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// kexecLoadedFile reads "1" once a kernel has been loaded with kexec -l.
+const kexecLoadedFile = "/sys/kernel/kexec_loaded"
+
+func kexecRequested(action string) bool {
+	// Report whether --kexec applies to the action. A command configured for
+	// the action in the config file takes precedence.
+	_, overridden := commandOverrides[action]
+	return action == "reboot" && *(appFlags[kexecIndex].value.(*bool)) && !overridden
+}
+
+func kexecCommand() ([]string, error) {
+	// Return the command booting straight into the kernel loaded with kexec -l,
+	// without going through the firmware: systemctl kexec where systemd can stop
+	// the services first, kexec -e otherwise. The error explains why a full
+	// reboot is needed instead.
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("kexec is not supported on %s", runtime.GOOS)
+	}
+	data, err := os.ReadFile(kexecLoadedFile)
+	if err != nil || strings.TrimSpace(string(data)) != "1" {
+		return nil, errors.New("no kernel is loaded for kexec; load one with kexec -l")
+	}
+	if systemdAvailable() {
+		return []string{"systemctl", "kexec"}, nil
+	}
+	if _, err := exec.LookPath("kexec"); err != nil {
+		return nil, fmt.Errorf("kexec is not installed: %v", err)
+	}
+	return []string{"kexec", "-e"}, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+func systemLoad() (float64, error) {
+	// Report the 1-minute load average.
+	switch runtime.GOOS {
+	case "linux":
+		data, err := os.ReadFile("/proc/loadavg")
+		if err != nil {
+			return 0, err
+		}
+		fields := strings.Fields(string(data))
+		if len(fields) == 0 {
+			return 0, errors.New("unexpected /proc/loadavg format")
+		}
+		return strconv.ParseFloat(fields[0], 64)
+	case "darwin", "freebsd", "openbsd", "netbsd":
+		// vm.loadavg reads "{ 0.52 0.41 0.38 }".
+		output, err := exec.Command("sysctl", "-n", "vm.loadavg").Output()
+		if err != nil {
+			return 0, fmt.Errorf("reading vm.loadavg: %v", err)
+		}
+		fields := strings.Fields(strings.Trim(strings.TrimSpace(string(output)), "{}"))
+		if len(fields) == 0 {
+			return 0, fmt.Errorf("unexpected vm.loadavg format: %q", output)
+		}
+		return strconv.ParseFloat(fields[0], 64)
+	default:
+		return 0, fmt.Errorf("the load average is not available on %s", runtime.GOOS)
+	}
+}
+
+// vmStatPattern matches the page counts printed by vm_stat on darwin.
+var vmStatPattern = regexp.MustCompile(`(?m)^Pages (free|inactive|speculative):\s+(\d+)\.`)
+
+// vmStatPageSize matches the page size in the first line of vm_stat.
+var vmStatPageSize = regexp.MustCompile(`page size of (\d+) bytes`)
+
+func freeMemory() (uint64, error) {
+	// Report how many bytes of memory are available without swapping.
+	switch runtime.GOOS {
+	case "linux":
+		file, err := os.Open("/proc/meminfo")
+		if err != nil {
+			return 0, err
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			// MemAvailable:    8048556 kB
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+				kb, err := strconv.ParseUint(fields[1], 10, 64)
+				if err != nil {
+					return 0, fmt.Errorf("unexpected /proc/meminfo format: %v", err)
+				}
+				return kb * 1024, nil
+			}
+		}
+		return 0, errors.New("MemAvailable not found in /proc/meminfo")
+	case "windows":
+		return windowsFreeMemory()
+	case "freebsd":
+		output, err := exec.Command("sysctl", "-n", "vm.stats.vm.v_free_count", "vm.stats.vm.v_inactive_count", "hw.pagesize").Output()
+		if err != nil {
+			return 0, fmt.Errorf("reading memory statistics: %v", err)
+		}
+		fields := strings.Fields(string(output))
+		if len(fields) != 3 {
+			return 0, fmt.Errorf("unexpected memory statistics: %q", output)
+		}
+		var values [3]uint64
+		for i, field := range fields {
+			if values[i], err = strconv.ParseUint(field, 10, 64); err != nil {
+				return 0, fmt.Errorf("unexpected memory statistics: %v", err)
+			}
+		}
+		return (values[0] + values[1]) * values[2], nil
+	case "darwin":
+		output, err := exec.Command("vm_stat").Output()
+		if err != nil {
+			return 0, fmt.Errorf("running vm_stat: %v", err)
+		}
+		size := vmStatPageSize.FindSubmatch(output)
+		if size == nil {
+			return 0, errors.New("page size not found in vm_stat output")
+		}
+		pageSize, _ := strconv.ParseUint(string(size[1]), 10, 64)
+		var pages uint64
+		for _, match := range vmStatPattern.FindAllSubmatch(output, -1) {
+			n, _ := strconv.ParseUint(string(match[2]), 10, 64)
+			pages += n
+		}
+		return pages * pageSize, nil
+	default:
+		return 0, fmt.Errorf("free memory is not available on %s", runtime.GOOS)
+	}
+}
+
+func checkMaxLoad() (bool, string, error) {
+	// Compare the 1-minute load average with --max-load, which was validated at
+	// startup. The error reports a load average that cannot be read.
+	limit, _ := strconv.ParseFloat(*(appFlags[maxLoadIndex].value.(*string)), 64)
+	load, err := systemLoad()
+	if err != nil {
+		return true, "", err
+	}
+	return load <= limit, fmt.Sprintf("load average %.2f, limit %g", load, limit), nil
+}
+
+func checkMinFreeMem() (bool, string, error) {
+	// Compare the available memory with --min-free-mem. The error reports
+	// memory statistics that cannot be read.
+	limit := getFlagInt(minFreeMemIndex)
+	free, err := freeMemory()
+	if err != nil {
+		return true, "", err
+	}
+	freeMB := free / (1024 * 1024)
+	return freeMB >= uint64(limit), fmt.Sprintf("%d MB available, minimum %d MB", freeMB, limit), nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// errLockHeld reports that another process holds the action lock.
+var errLockHeld = errors.New("lock is held by another process")
+
+// actionLock is the open lock file while this process holds the action lock.
+var actionLock *os.File
+
+func getLockFilePath() string {
+	// The lock file lives next to the log file, like the state files.
+	return filepath.Join(getLogFileDirectory(), appName+".lock")
+}
+
+// acquireActionLock makes sure only one sysreboot action is pending at a time
+// by taking an exclusive lock on the lock file (flock on Unix-like systems,
+// LockFileEx on Windows). The lock is released by releaseActionLock or, at the
+// latest, by the OS when the process exits. If another process holds it, the
+// error describes the action that process is waiting for.
+func acquireActionLock() error {
+	path := getLockFilePath()
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("opening lock file: %v", err)
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		if errors.Is(err, errLockHeld) {
+			return pendingActionError()
+		}
+		return fmt.Errorf("locking %s: %v", path, err)
+	}
+	actionLock = file
+	return nil
+}
+
+func releaseActionLock() {
+	// Closing the lock file releases the lock.
+	if actionLock != nil {
+		actionLock.Close()
+		actionLock = nil
+	}
+}
+
+func pendingActionError() error {
+	// Describe the action another sysreboot process holds the lock for.
+	states, _ := livePendingStates()
+	if len(states) == 0 {
+		return fmt.Errorf("another %s process is already performing an action", appName)
+	}
+	state := states[0]
+	return fmt.Errorf("a %s is already pending at %s (PID %d); cancel it first with --cancel", state.Action, state.Time.Format("2006-01-02 15:04"), state.PID)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Supported log formats.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// Supported log targets.
+const (
+	logTargetFile     = "file"
+	logTargetStdout   = "stdout"
+	logTargetSyslog   = "syslog"
+	logTargetEventLog = "eventlog"
+)
+
+func stdoutLogStream(output string) *os.File {
+	// Pick the stream for --log-target stdout. With --output json, stdout is
+	// reserved for the status objects, so the log entries go to stderr instead
+	// of interleaving with them.
+	if output == outputJSON {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// logFileKeep is the number of rotated log files kept next to the active one.
+const logFileKeep = 3
+
+// levelWriter is a log destination that records the severity of each message,
+// such as *syslog.Writer or the Windows Event Log.
+type levelWriter interface {
+	Info(m string) error
+	Err(m string) error
+}
+
+// appLogger writes log entries either as plain text lines or as JSON objects.
+type appLogger struct {
+	mu     sync.Mutex
+	out    io.Writer   // Destination of the log entries.
+	sys    levelWriter // System log destination; used instead of out when set.
+	format string      // Output format, logFormatText or logFormatJSON.
+	host   string      // Hostname identifying the machine in every entry.
+	tag    string      // Optional fleet or role identifier added to every entry.
+	action string      // Action being performed, recorded in JSON entries.
+}
+
+// logEntry is the JSON representation of a single log line.
+type logEntry struct {
+	Timestamp string `json:"timestamp"`
+	Level     string `json:"level"`
+	Host      string `json:"host"`
+	Tag       string `json:"tag,omitempty"`
+	Action    string `json:"action,omitempty"`
+	Message   string `json:"message"`
+	Source    string `json:"source"`
+}
+
+func newAppLogger(out io.Writer, host string, tag string) *appLogger {
+	// Create a logger that writes plain text until another format is selected.
+	return &appLogger{out: out, format: logFormatText, host: host, tag: tag}
+}
+
+func newSyslogLogger(sys levelWriter, host string, tag string) *appLogger {
+	// Create a logger that sends its entries to the system log.
+	return &appLogger{sys: sys, format: logFormatText, host: host, tag: tag}
+}
+
+func (l *appLogger) setFormat(format string) error {
+	// Select the output format for subsequent entries.
+	switch format {
+	case logFormatText, logFormatJSON:
+		l.mu.Lock()
+		l.format = format
+		l.mu.Unlock()
+		return nil
+	default:
+		return fmt.Errorf("invalid log format %q (expected %s or %s)", format, logFormatText, logFormatJSON)
+	}
+}
+
+func (l *appLogger) setAction(action string) {
+	// Record the action so that later entries can be attributed to it.
+	l.mu.Lock()
+	l.action = action
+	l.mu.Unlock()
+}
+
+// Info logs an informational message.
+func (l *appLogger) Info(message string) {
+	l.output("info", message)
+}
+
+// Infof logs a formatted informational message.
+func (l *appLogger) Infof(format string, args ...interface{}) {
+	l.output("info", fmt.Sprintf(format, args...))
+}
+
+// Error logs an error message.
+func (l *appLogger) Error(message string) {
+	l.output("error", message)
+}
+
+// Errorf logs a formatted error message.
+func (l *appLogger) Errorf(format string, args ...interface{}) {
+	l.output("error", fmt.Sprintf(format, args...))
+}
+
+func (l *appLogger) output(level, message string) {
+	// Write one entry, attributing it to the caller of the exported logging method.
+	source := "???:0"
+	if _, file, line, ok := runtime.Caller(2); ok {
+		source = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+	message = strings.TrimSuffix(message, "\n")
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.format == logFormatJSON {
+		data, err := json.Marshal(logEntry{
+			Timestamp: now.Format(time.RFC3339),
+			Level:     level,
+			Host:      l.host,
+			Tag:       l.tag,
+			Action:    l.action,
+			Message:   message,
+			Source:    source,
+		})
+		if err == nil {
+			l.write(level, string(data))
+		}
+		return
+	}
+	if l.sys != nil {
+		// The system log records the time, host and program name itself.
+		if l.tag != "" {
+			message = "[" + l.tag + "] " + message
+		}
+		l.write(level, source+": "+message)
+		return
+	}
+	label := l.host
+	if l.tag != "" {
+		label += " [" + l.tag + "]"
+	}
+	fmt.Fprintf(l.out, "%s %s: %s %s: %s\n", label, appName, now.Format("2006/01/02 15:04:05"), source, message)
+}
+
+func (l *appLogger) write(level, line string) {
+	// Send one formatted entry to the configured destination. The caller holds l.mu.
+	if l.sys == nil {
+		io.WriteString(l.out, line+"\n")
+	} else if level == "error" {
+		l.sys.Err(line)
+	} else {
+		l.sys.Info(line)
+	}
+}
+
+func openLogFile(path string, maxSize int64) (*os.File, error) {
+	// Open the log file for appending, rotating it first if it has grown past
+	// maxSize bytes. A maxSize of zero or less disables rotation.
+	if info, err := os.Stat(path); err == nil && maxSize > 0 && info.Size() >= maxSize {
+		if err := rotateLogFile(path, logFileKeep); err != nil {
+			return nil, fmt.Errorf("rotating log file: %v", err)
+		}
+	}
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+}
+
+func rotateLogFile(path string, keep int) error {
+	// Shift path.1 .. path.(keep-1) up by one, dropping the oldest, and move the
+	// current log to path.1.
+	if err := os.Remove(fmt.Sprintf("%s.%d", path, keep)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := keep - 1; i >= 1; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(path, path+".1")
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeLogGeneration(t *testing.T, path string, content string) {
+	// Append content to the log through openLogFile with a 10-byte threshold.
+	t.Helper()
+	f, err := openLogFile(path, 10)
+	if err != nil {
+		t.Fatalf("openLogFile: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestOpenLogFileAppendsBelowThreshold(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sysreboot.log")
+	writeLogGeneration(t, path, "short\n")
+	writeLogGeneration(t, path, "ok\n")
+
+	if got := readLog(t, path); got != "short\nok\n" {
+		t.Errorf("log = %q, want both writes appended", got)
+	}
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Errorf("log was rotated below the size threshold")
+	}
+}
+
+func TestOpenLogFileRotatesAtThreshold(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sysreboot.log")
+	writeLogGeneration(t, path, strings.Repeat("a", 10))
+	writeLogGeneration(t, path, "b\n")
+
+	if got := readLog(t, path); got != "b\n" {
+		t.Errorf("log = %q, want a fresh file", got)
+	}
+	if got := readLog(t, path+".1"); got != strings.Repeat("a", 10) {
+		t.Errorf("log.1 = %q, want the previous log", got)
+	}
+}
+
+func TestOpenLogFileKeepsGenerations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sysreboot.log")
+	for i := 0; i < logFileKeep+3; i++ {
+		writeLogGeneration(t, path, fmt.Sprintf("generation %d\n", i))
+	}
+
+	// The newest generation is active, the ones before it are numbered from
+	// the most recent, and nothing beyond logFileKeep is left.
+	last := logFileKeep + 2
+	if got, want := readLog(t, path), fmt.Sprintf("generation %d\n", last); got != want {
+		t.Errorf("log = %q, want %q", got, want)
+	}
+	for i := 1; i <= logFileKeep; i++ {
+		if got, want := readLog(t, fmt.Sprintf("%s.%d", path, i)), fmt.Sprintf("generation %d\n", last-i); got != want {
+			t.Errorf("log.%d = %q, want %q", i, got, want)
+		}
+	}
+	if _, err := os.Stat(fmt.Sprintf("%s.%d", path, logFileKeep+1)); !os.IsNotExist(err) {
+		t.Errorf("more than %d rotated logs were kept", logFileKeep)
+	}
+}
+
+func TestOpenLogFileWithoutLimitNeverRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sysreboot.log")
+	for i := 0; i < 2; i++ {
+		f, err := openLogFile(path, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(strings.Repeat("x", 20))
+		f.Close()
+	}
+	if got := readLog(t, path); len(got) != 40 {
+		t.Errorf("log holds %d bytes, want 40 without rotation", len(got))
+	}
+}
+
+func TestStdoutLogStream(t *testing.T) {
+	tests := []struct {
+		output string
+		want   *os.File
+	}{
+		{outputText, os.Stdout},
+		{outputJSON, os.Stderr},
+	}
+	for _, tt := range tests {
+		if got := stdoutLogStream(tt.output); got != tt.want {
+			t.Errorf("stdoutLogStream(%q) = %s, want %s", tt.output, got.Name(), tt.want.Name())
+		}
+	}
+}
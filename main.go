@@ -6,14 +6,27 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math/rand"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
 	"time"
+
+	"sysreboot/reboot"
 )
 
 // Constants for application metadata
@@ -22,21 +35,148 @@ const (
 	appVersion = "0.1.2"
 )
 
-// Enumeration for index mapping of the flags
+// Build metadata, set with -ldflags "-X main.gitCommit=... -X main.buildDate=...".
+// When empty, the VCS information recorded by the Go toolchain is used instead.
+var (
+	gitCommit string
+	buildDate string
+)
+
+// Exit codes returned by the application.
 const (
-	haltIndex = iota
-	poweroffIndex
-	rebootIndex
-	delayIndex
-	messageIndex
+	exitSuccess   = 0 // The action was performed, scheduled, or not needed.
+	exitFailure   = 1 // The action or a command it depends on failed.
+	exitUsage     = 2 // The command-line arguments are invalid.
+	exitCancelled = 3 // The action was cancelled before it was executed.
+)
+
+// confirmEnvVar holds a confirmation answer for non-interactive use.
+const confirmEnvVar = "SYSREBOOT_CONFIRM"
+
+// errCancelled reports that the action was declined before it was executed.
+var errCancelled = errors.New("action cancelled")
+
+// usageError marks an error caused by invalid command-line arguments.
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string {
+	return e.err.Error()
+}
+
+// rebootRequiredFile is created by Debian/Ubuntu package upgrades that need a reboot.
+const rebootRequiredFile = "/var/run/reboot-required"
+
+// Enumeration for index mapping of the flags (must follow the order of appFlags)
+const (
+	abortFileIndex = iota
+	actionIndex
+	bellIndex
+	cancelIndex
+	cancelWindowIndex
+	categoryIndex
+	checkIndex
+	commandTimeoutIndex
 	confirmIndex
+	confirmDefaultIndex
+	confirmPhraseIndex
 	confirmTimeoutIndex
-	verboseIndex
+	confirmWhenIndex
+	daemonIndex
+	dateIndex
+	delayIndex
+	dryRunIndex
+	dumpConfigIndex
+	explainIndex
+	forceIndex
+	graceIndex
+	haltIndex
+	helpIndex
+	hibernateIndex
+	hookTimeoutIndex
+	idleThresholdIndex
+	ifIdleIndex
+	ifRequiredIndex
+	ignoreHookErrorsIndex
+	ignoreInhibitorsIndex
+	jitterIndex
+	kexecIndex
+	lastIndex
+	listIndex
+	logFormatIndex
+	logMaxSizeIndex
+	logTargetIndex
+	maxLoadIndex
+	maxUptimeIndex
+	messageIndex
+	messageFileIndex
+	minDelayIndex
+	minFreeMemIndex
+	noColorIndex
+	noTimeoutIndex
+	notifyIndex
+	notifyOnlyIndex
+	notifyUserIndex
+	nowIndex
+	outputIndex
+	poweroffIndex
+	preHookIndex
+	quietIndex
+	reasonIndex
+	rebootIndex
+	repeatIndex
+	reportBootIndex
+	retryIndex
+	shutdownIndex
+	shutdownBinIndex
+	statusFileIndex
+	stdinIndex
+	suspendIndex
+	syncIndex
+	tagIndex
+	tagMessageIndex
 	timeIndex
+	timezoneIndex
+	useAtIndex
+	useSystemdShutdownIndex
+	verboseIndex
 	versionIndex
-	shutdownIndex
+	waitIndex
+	wakeAtIndex
+	wallIndex
+	warnAtIndex
+	webhookIndex
+	webhookRequiredIndex
 )
 
+// confirmOptions controls how confirmAction waits for an answer.
+type confirmOptions struct {
+	timeout          time.Duration // How long to wait for an answer; zero waits indefinitely.
+	proceedOnTimeout bool          // Whether an unanswered prompt proceeds or aborts.
+	phrase           string        // Exact answer required to proceed; empty accepts the configured responses.
+}
+
+func (o confirmOptions) accepts(answer string) bool {
+	// Report whether an answer confirms the action.
+	if o.phrase != "" {
+		return strings.TrimSpace(answer) == o.phrase
+	}
+	return isAffirmative(answer)
+}
+
+// stringList is a flag value that collects every occurrence of a repeated flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 // flagData defines the structure for command-line flag information.
 type flagData struct {
 	longName   string      // Long form of the flag.
@@ -49,62 +189,146 @@ type flagData struct {
 // appFlags holds the configuration for all command-line flags.
 var appFlags = []flagData{
 	// Flags are organized alphabetically by longName for readability.
+	{"abort-file", "af", new(string), "", "Cancel a delayed or scheduled action when this file appears (default: abort next to the config file)."},
+	{"action", "a", new(string), "", "Action to perform: reboot, poweroff (or shutdown), halt, suspend or hibernate."},
+	{"bell", "bl", new(bool), false, "Ring the terminal bell every second of the confirmation prompt and the cancel window, and right before the action runs."},
+	{"cancel", "x", new(bool), false, "Cancel a pending delayed or scheduled action."},
+	{"cancel-window", "cw", new(int), 0, "Seconds to wait right before the action runs, during which pressing Enter aborts it (0 disables)."},
+	{"category", "cg", new(string), "", "Category of the action: emergency, routine or maintenance; seeds the confirmation, delay and warning options."},
+	{"check", "ck", new(bool), false, "Evaluate every check that would stop the action, report PASS or FAIL for each and exit without doing anything."},
+	{"command-timeout", "cmt", new(int), 30, "Seconds to wait for the system command to finish before killing it (0 waits indefinitely)."},
 	{"confirm", "c", new(bool), false, "Require confirmation before performing the action."},
+	{"confirm-default", "cd", new(string), "proceed", "What to do when the confirmation times out: proceed or abort."},
+	{"confirm-phrase", "cp", new(string), "", "Require typing this exact phrase instead of y to confirm the action; implies --confirm."},
 	{"confirm-timeout", "ct", new(int), 10, "Confirmation timeout in seconds."},
+	{"confirm-when", "cwh", new(string), "start", "When to ask for confirmation of a delayed or scheduled action: start (before the wait) or end (right before it runs)."},
+	{"daemon", "dm", new(bool), false, "Detach from the terminal and wait for the delayed or scheduled action in the background, surviving logout."},
+	{"date", "dt", new(string), "", "Date for the action in YYYY-MM-DD format; requires --time in HH:MM format."},
 	{"delay", "d", new(int), 0, "Delay in minutes before performing the action."},
-	{"halt", "h", new(bool), false, "Halt the machine."},
-	{"message", "m", new(string), "", "Message to send to all users before performing the action."},
+	{"dry-run", "n", new(bool), false, "Print the commands that would be run without executing them."},
+	{"dump-config", "dc", new(bool), false, "Print a commented config file template with every option and its default, and exit."},
+	{"explain", "ex", new(bool), false, "Describe in plain English what would happen with the options given, and exit without doing anything."},
+	{"force", "f", new(bool), false, "Skip confirmation and the --if-required, --if-idle and --max-uptime checks."},
+	{"grace", "g", new(int), 0, "Seconds to wait after warning users, before a final warning and a short countdown to the action (0 disables)."},
+	{"halt", "hl", new(bool), false, "Halt the machine."},
+	{"help", "h", new(bool), false, "Show this help message and exit."},
+	{"hibernate", "hb", new(bool), false, "Hibernate the machine (Linux, Windows and OpenBSD)."},
+	{"hook-timeout", "ht", new(int), 60, "Seconds to wait for each pre-hook to finish."},
+	{"idle-threshold", "it", new(int), 0, "With --if-idle, treat sessions idle for at least this many minutes as inactive."},
+	{"if-idle", "ii", new(bool), false, "Only perform the action if no users are logged in."},
+	{"if-required", "ir", new(bool), false, "Only perform the action if the system reports that a reboot is required (Linux)."},
+	{"ignore-hook-errors", "ihe", new(bool), false, "Proceed with the action even if a pre-hook fails."},
+	{"ignore-inhibitors", "iin", new(bool), false, "Perform the action even while an application holds a systemd inhibitor lock against shutdown (Linux)."},
+	{"jitter", "j", new(string), "", "Add a random offset between 0 and this duration (e.g. 5m) to the delay or scheduled time."},
+	{"kexec", "kx", new(bool), false, "With --reboot, boot straight into the kernel loaded with kexec -l, skipping the firmware (Linux); falls back to a full reboot if none is loaded."},
+	{"last", "la", new(bool), false, "Show when, why and by whom sysreboot last performed an action."},
+	{"list", "l", new(bool), false, "List pending delayed or scheduled actions."},
+	{"log-format", "lf", new(string), logFormatText, "Log file format: text or json."},
+	{"log-max-size", "lms", new(int), 10, "Rotate the log file when it exceeds this size in MB (0 disables rotation)."},
+	{"log-target", "lt", new(string), logTargetFile, "Where to write log entries: file, stdout (stderr with --output json), syslog (Unix) or eventlog (Windows)."},
+	{"max-load", "ml", new(string), "", "Only perform the action if the 1-minute load average is at most this value, e.g. 4.0."},
+	{"max-uptime", "mu", new(string), "", "Only perform the action if the system has been up at least this long, e.g. 7d or 12h."},
+	{"message", "m", new(stringList), nil, "Message to send to all users before performing the action; %s is replaced by the time remaining. Repeat it to pair each message with a --warn-at checkpoint in turn."},
+	{"message-file", "mf", new(string), "", "Read the message to send to all users from this file instead of --message."},
+	{"min-delay", "md", new(int), 0, "Minimum delay in seconds enforced for poweroff and halt, overriding a shorter --delay or --wait."},
+	{"min-free-mem", "mfm", new(int), 0, "Only perform the action if at least this many MB of memory are available (0 disables)."},
+	{"no-color", "nc", new(bool), false, "Never color interactive output; setting the NO_COLOR environment variable does the same."},
+	{"no-timeout", "nt", new(bool), false, "Wait for a confirmation answer indefinitely."},
+	{"notify", "nf", new(bool), true, "Deliver the message as a desktop notification; --notify=false turns it off."},
+	{"notify-only", "no", new(bool), false, "Only broadcast --message and send the webhook, without performing or scheduling the action."},
+	{"notify-user", "nu", new(stringList), nil, "Write the terminal message only to this logged-in user instead of everyone (repeatable)."},
+	{"now", "nw", new(bool), false, "Perform the action right away, without any wait, warning or confirmation (unless --confirm is given too)."},
+	{"output", "o", new(string), outputText, "Format of the output on stdout: text or json (one status object per line)."},
 	{"poweroff", "p", new(bool), false, "Power-off the machine."},
-	{"reboot", "r", new(bool), true, "Reboot the machine (default action)."},
+	{"pre-hook", "ph", new(stringList), nil, "Executable to run with the action name before the action (repeatable)."},
+	{"quiet", "q", new(bool), false, "Suppress informational output; errors are still printed and everything is logged."},
+	{"reason", "rs", new(string), "", "Reason for the action, recorded in the log and appended to the message."},
+	{"reboot", "r", new(bool), false, "Reboot the machine (default action)."},
+	{"repeat", "rp", new(string), "", "With --time HH:MM, install a recurring daily or weekly schedule for the action instead of waiting."},
+	{"report-boot", "rb", new(bool), false, "Run at boot: confirm to the --webhook that a reboot performed by sysreboot completed, then exit."},
+	{"retry", "rt", new(int), 0, "Retry a failing system command this many times, waiting longer after each attempt."},
 	{"shutdown", "s", new(bool), false, "Shutdown the machine (alias for poweroff)."},
-	{"time", "t", new(string), "", "Specific time for the action in HH:MM format (24-hour)."},
+	{"shutdown-bin", "sb", new(string), "", "Executable to perform the action with instead of the OS default; the OS-appropriate arguments are kept."},
+	{"status-file", "sf", new(string), "", "Keep the phase and seconds remaining of a wait in this JSON file, updated every second and removed when the wait ends."},
+	{"stdin", "si", new(bool), false, "Read directives such as \"reboot +5m reason=maintenance\" from stdin, one per line, and run each in turn."},
+	{"suspend", "sp", new(bool), false, "Suspend the machine to RAM."},
+	{"sync", "sy", new(bool), false, "Flush file system buffers to disk right before the action runs (Linux)."},
+	{"tag", "tg", new(string), "", "Fleet or role identifier added to every log line."},
+	{"tag-message", "tm", new(bool), false, "Prefix broadcast messages with the hostname and tag."},
+	{"time", "t", new(string), "", "Specific time for the action in HH:MM format (24-hour), an offset such as +30m, now, or cancel to cancel a pending action."},
+	{"timezone", "tz", new(string), "", "IANA time zone, e.g. Europe/Berlin, in which --date, --time and --wake-at are interpreted (default: local time)."},
+	{"use-at", "ua", new(bool), false, "Submit delayed and scheduled actions to the at daemon and exit instead of waiting (Unix)."},
+	{"use-systemd-shutdown", "uss", new(bool), false, "Schedule delayed actions with systemd's shutdown command and exit instead of waiting (Linux)."},
 	{"verbose", "vb", new(bool), false, "Output more information."},
 	{"version", "v", new(bool), false, "Show application version."},
+	{"wait", "w", new(string), "", "Delay before performing the action as a duration such as 30s, 10m or 3h."},
+	{"wake-at", "wa", new(string), "", "With --poweroff, set the RTC wake alarm to power back on at HH:MM or after an offset such as +8h (Linux)."},
+	{"wall", "wl", new(bool), true, "Deliver the message to every terminal with wall (msg on Windows); --wall=false turns it off."},
+	{"warn-at", "wn", new(string), "", "Comma-separated times before the action, e.g. 30m,10m,1m, at which to broadcast the message instead of the default checkpoints."},
+	{"webhook", "wh", new(string), "", "URL to POST a JSON notification to right before the action is executed."},
+	{"webhook-required", "whr", new(bool), false, "Abort the action if the webhook notification fails."},
 }
 
 var (
-	logFile string      // Path to the log file.
-	logger  *log.Logger // Logger instance for the application.
+	logFile string     // Path to the log file.
+	logger  *appLogger // Logger instance for the application.
+
+	// effectiveUID returns the effective user ID; replaceable for testing.
+	effectiveUID = os.Geteuid
 )
 
 func init() {
+	defineFlags(flag.CommandLine)
+
+	// Override the default flag usage message with a custom one.
+	flag.Usage = customUsage
+}
+
+func defineFlags(fs *flag.FlagSet) {
 	// Initialize command-line flags based on appFlags configuration.
 	for _, fd := range appFlags {
 		switch v := fd.value.(type) {
 		case *bool:
-			flag.BoolVar(v, fd.longName, fd.defaultVal.(bool), fd.usage)
-			flag.BoolVar(v, fd.shortName, fd.defaultVal.(bool), fd.usage+" (short form)")
+			fs.BoolVar(v, fd.longName, fd.defaultVal.(bool), fd.usage)
+			fs.BoolVar(v, fd.shortName, fd.defaultVal.(bool), fd.usage+" (short form)")
 		case *int:
-			flag.IntVar(v, fd.longName, fd.defaultVal.(int), fd.usage)
-			flag.IntVar(v, fd.shortName, fd.defaultVal.(int), fd.usage+" (short form)")
+			fs.IntVar(v, fd.longName, fd.defaultVal.(int), fd.usage)
+			fs.IntVar(v, fd.shortName, fd.defaultVal.(int), fd.usage+" (short form)")
 		case *string:
-			flag.StringVar(v, fd.longName, fd.defaultVal.(string), fd.usage)
-			flag.StringVar(v, fd.shortName, fd.defaultVal.(string), fd.usage+" (short form)")
+			fs.StringVar(v, fd.longName, fd.defaultVal.(string), fd.usage)
+			fs.StringVar(v, fd.shortName, fd.defaultVal.(string), fd.usage+" (short form)")
+		case flag.Value:
+			fs.Var(v, fd.longName, fd.usage)
+			fs.Var(v, fd.shortName, fd.usage+" (short form)")
 		}
 	}
-
-	// Set up the log file location and initialize the logger.
-	logFile = filepath.Join(getLogFileDirectory(), appName+".log")
-	file, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	if err != nil {
-		log.Fatalf("Error opening log file: %v", err)
-	}
-	logger = log.New(file, appName+": ", log.Ldate|log.Ltime|log.Lshortfile)
-
-	// Override the default flag usage message with a custom one.
-	flag.Usage = customUsage
 }
 
 func getLogFileDirectory() string {
-	// Get the appropriate log file directory based on the operating system.
+	// Get the appropriate log file directory based on the operating system:
+	// %APPDATA%\sysreboot on Windows, and $XDG_STATE_HOME/sysreboot (by default
+	// ~/.local/state/sysreboot) elsewhere. The directory is created if needed.
+	var dir string
 	if runtime.GOOS == "windows" {
-		return os.Getenv("APPDATA")
+		appData := os.Getenv("APPDATA")
+		if appData == "" {
+			log.Fatalf("Error getting log file directory: %%APPDATA%% is not set")
+		}
+		dir = filepath.Join(appData, appName)
+	} else if stateHome := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(stateHome) {
+		// The XDG spec says relative paths are invalid and must be ignored.
+		dir = filepath.Join(stateHome, appName)
+	} else {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			log.Fatalf("Error getting user home directory: %v", err)
+		}
+		dir = filepath.Join(homeDir, ".local", "state", appName)
 	}
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		log.Fatalf("Error getting user home directory: %v", err)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Fatalf("Error creating log file directory: %v", err)
 	}
-	return homeDir
+	return dir
 }
 
 func customUsage() {
@@ -115,185 +339,2078 @@ func customUsage() {
 	flag.PrintDefaults()
 	fmt.Fprintf(os.Stderr, "\nExamples:\n")
 	fmt.Fprintf(os.Stderr, "  %s --reboot --delay 5 --message \"System will reboot in 5 minutes!\"\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --now\n", appName)
 	fmt.Fprintf(os.Stderr, "  %s --poweroff --confirm\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --delay 30 --confirm --confirm-when end\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --poweroff --confirm-phrase \"POWEROFF prod-db\"\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --cancel-window 10\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --confirm --bell\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --delay 5 --no-color\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --poweroff --wake-at 06:00\n", appName)
 	fmt.Fprintf(os.Stderr, "  %s --shutdown --confirm\n", appName)
 	fmt.Fprintf(os.Stderr, "  %s --halt --verbose\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --suspend --delay 10\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --action poweroff --confirm\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --list\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --dump-config > ~/.config/sysreboot/config\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --last\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --report-boot\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --delay 30 --abort-file /run/sysreboot.abort\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --delay 30 --status-file /run/sysreboot.status\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --cancel\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --poweroff --dry-run\n", appName)
+	fmt.Fprintf(os.Stderr, "  echo \"reboot +5m reason=maintenance\" | %s --stdin --dry-run\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --if-idle --max-uptime 7d --check\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --time 23:00 --confirm --message \"Rebooting in %%s\" --explain\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --if-idle --force\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --time +1h30m\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --time now\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --time cancel\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --date 2026-11-03 --time 02:00\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --time 02:00 --timezone America/New_York\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --time 03:00 --repeat weekly --if-idle\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --wait 30s\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --delay 60 --warn-at 30m,10m,1m --message \"Rebooting in %%s\"\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --delay 60 --warn-at 30m,1m --message \"Reboot in %%s, please save your work\" --message \"Rebooting in %%s\"\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --delay 10 --grace 120 --message \"Rebooting in %%s\"\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --time 02:00 --jitter 15m\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --time 02:00 --daemon\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --time 02:00 --use-at\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --category emergency --reason \"Kernel exploit\"\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --delay 5 --quiet\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --delay 5 --output json\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --pre-hook /usr/local/bin/flush-cache --pre-hook /usr/local/bin/checkpoint-db\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --if-required\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --if-idle --idle-threshold 60\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --ignore-inhibitors\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --max-uptime 7d\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --max-load 2.5 --min-free-mem 512\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --reason \"Kernel update\" --message \"Rebooting now\"\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --delay 15 --message-file /etc/sysreboot/notice.txt\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --time 22:00 --reason updates --message \"Host {{.Host}} reboots at {{.Time}} for {{.Reason}}\"\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --delay 15 --message \"Rebooting in %%s\" --wall=false\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --delay 15 --message \"Rebooting in %%s\" --notify-user alice\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --notify-only --time 22:00 --message \"Maintenance reboot in %%s\"\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --log-target syslog\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --log-target stdout --log-format json\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --log-target eventlog --reason \"Patch Tuesday\"\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --shutdown-bin /usr/bin/loginctl\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --retry 3\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --poweroff --sync\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s --reboot --kexec\n", appName)
+	fmt.Fprintf(os.Stderr, "\nExit codes:\n")
+	fmt.Fprintf(os.Stderr, "  %d  success (action performed, scheduled, or not needed)\n", exitSuccess)
+	fmt.Fprintf(os.Stderr, "  %d  the action or a command it depends on failed\n", exitFailure)
+	fmt.Fprintf(os.Stderr, "  %d  invalid arguments\n", exitUsage)
+	fmt.Fprintf(os.Stderr, "  %d  the action was cancelled before it was executed\n", exitCancelled)
+}
+
+func printVersion() {
+	// Print the version together with the build metadata useful in bug reports.
+	commit, date, modified := gitCommit, buildDate, false
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if commit == "" {
+					commit = setting.Value
+				}
+			case "vcs.time":
+				if date == "" {
+					date = setting.Value
+				}
+			case "vcs.modified":
+				modified = setting.Value == "true" && gitCommit == ""
+			}
+		}
+	}
+	if commit == "" {
+		commit = "unknown"
+	} else if modified {
+		commit += " (modified)"
+	}
+	if date == "" {
+		date = "unknown"
+	}
+
+	fmt.Printf("%s version %s\n", appName, appVersion)
+	fmt.Printf("  commit:   %s\n", commit)
+	fmt.Printf("  built:    %s\n", date)
+	fmt.Printf("  go:       %s\n", runtime.Version())
+	fmt.Printf("  platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
 }
 
-func scheduleAtSpecificTime(timeStr string, action string, message string, confirmation bool) error {
+func scheduleAtSpecificTime(ctx context.Context, dateStr string, timeStr string, action string, message string, confirmation bool, dryRun bool) error {
 	// Schedule an action (reboot, shutdown, etc.) to occur at a specific time.
-	rebootTime, err := time.Parse("15:04", timeStr)
+	now := scheduleNow()
+	rebootTime, err := reboot.Schedule(reboot.Options{Action: action, Date: dateStr, Time: timeStr, Now: now})
+	if err != nil {
+		return err
+	}
+	rebootTime = rebootTime.Add(jitterOffset(action))
+	window := rebootTime.Sub(now)
+	checkpoints, err := planWarnings(window, composeMessages())
+	if err != nil {
+		return usageError{err}
+	}
+	confirmation, err = confirmBeforeWait(ctx, confirmation)
 	if err != nil {
-		return fmt.Errorf("invalid time format: %v", err)
+		return err
 	}
 
-	// Calculate how long to wait until the specified time.
-	now := time.Now()
-	durationUntilReboot := time.Until(now.Truncate(24 * time.Hour).Add(time.Hour*time.Duration(rebootTime.Hour()) + time.Minute*time.Duration(rebootTime.Minute())))
-	if durationUntilReboot < 0 {
-		durationUntilReboot += 24 * time.Hour // Schedule for the next day if time is in the past.
+	// Time spent answering the confirmation comes off the wait, not the deadline.
+	now = scheduleNow()
+	durationUntilReboot := rebootTime.Sub(now)
+	setMessageSchedule(action, rebootTime)
+	armWarnings(rebootTime, window, checkpoints, composeMessages())
+
+	logger.Infof("%s scheduled at %s (in %s).\n", action, formatScheduleTime(rebootTime, now), humanizeDuration(durationUntilReboot))
+	printf("%s scheduled at %s (in %s).\n", action, formatScheduleTime(rebootTime, now), humanizeDuration(durationUntilReboot))
+	logger.Infof("%s due at %s.\n", action, rebootTime.UTC().Format(time.RFC3339))
+	logAudit(action, "scheduled for "+rebootTime.Format(time.RFC3339))
+	reportScheduled(action, rebootTime)
+
+	waitForAction(ctx, action, phaseScheduled, rebootTime) // Wait until the specified time.
+
+	// A config reload during the wait may have changed the message.
+	message = composeMessage()
+	gracePeriod(ctx, action, message, dryRun)
+	return executeAction(ctx, action, message, confirmation, dryRun)
+}
+
+func scheduleLocation() *time.Location {
+	// Return the zone --date, --time and --wake-at are interpreted in. The name
+	// is validated at startup, so a zone that fails to load here means local time.
+	name := *(appFlags[timezoneIndex].value.(*string))
+	if name == "" {
+		return time.Local
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Local
 	}
+	return location
+}
 
-	logger.Printf("%s scheduled at %s (in %s).\n", action, rebootTime.Format("15:04"), durationUntilReboot)
-	fmt.Printf("%s scheduled at %s (in %s).\n", action, rebootTime.Format("15:04"), durationUntilReboot)
+func scheduleNow() time.Time {
+	// Return the current time in the zone scheduled times are interpreted in.
+	return clock.Now().In(scheduleLocation())
+}
 
-	time.Sleep(durationUntilReboot) // Wait until the specified time.
-	executeAction(action, message, confirmation)
-	return nil
+func parseScheduleTime(timeStr string, now time.Time) (time.Duration, error) {
+	// Parse either a relative offset ("+30m", "+1h30m") or an absolute HH:MM time
+	// and return how long to wait from now.
+	target, err := reboot.ParseTime("", timeStr, now)
+	if err != nil {
+		return 0, err
+	}
+	return target.Sub(now), nil
 }
 
-func sendWallMessage(message string) {
-	// Send a message to all users on the system using the 'wall' command (Unix-like systems only).
-	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
-		if *(appFlags[verboseIndex].value.(*bool)) {
-			logger.Println("Wall message feature is not supported on this OS.")
-		}
-		return
+func formatScheduleTime(t, now time.Time) string {
+	// Show only the time of day for today's actions and include the date otherwise.
+	if y, m, d := t.Date(); y == now.Year() && m == now.Month() && d == now.Day() {
+		return t.Format("15:04")
 	}
+	return t.Format("2006-01-02 15:04")
+}
 
-	if *(appFlags[verboseIndex].value.(*bool)) {
-		logger.Println("Sending wall message.")
+func humanizeDuration(d time.Duration) string {
+	// Round a wait for display: whole seconds below an hour and whole minutes
+	// beyond, so messages read "in 4m30s" or "in 26h15m0s" instead of carrying
+	// sub-second noise.
+	if d >= time.Hour {
+		return d.Round(time.Minute).String()
 	}
-	cmd := exec.Command("wall", message)
-	err := cmd.Run()
-	if err != nil {
-		logger.Printf("Failed to send wall message: %v\n", err)
+	return d.Round(time.Second).String()
+}
+
+func waitForAction(ctx context.Context, action string, phase string, at time.Time) {
+	// Wait for a delayed or scheduled action to become due, exiting if ctx is
+	// cancelled (by SIGINT or SIGTERM in the CLI) or the abort file appears.
+	done := trackPendingAction(action, at)
+	completed, cause := waitWithCountdown(ctx, action, phase, at)
+	done()
+
+	if !completed {
+		printLine("Action cancelled by " + cause + ".")
+		logger.Info("Action cancelled by " + cause + ".")
+		reportResult(action, errCancelled)
+		os.Exit(exitSuccess)
 	}
 }
 
-func executeAction(action string, message string, confirmation bool) {
-	// Perform the requested action after optional confirmation and message broadcasting.
-	if confirmation && !confirmAction() {
-		fmt.Println("Action cancelled.")
-		logger.Println("Action cancelled by user.")
-		return
+// waitTick is how often a wait re-checks the clock, the abort file and the countdown.
+const waitTick = time.Second
+
+func waitWithCountdown(ctx context.Context, action string, phase string, deadline time.Time) (bool, string) {
+	// Wait until the deadline, redrawing a countdown line once per tick when
+	// stdout is a terminal so that piped output and logs stay clean. The abort
+	// file is checked and the --status-file rewritten on every tick. Returns
+	// false and the cause if ctx was cancelled or the abort file appeared.
+	//
+	// Rather than sleeping for the whole wait, the remaining time is recomputed
+	// from the wall clock on every tick. Go timers follow the monotonic clock,
+	// which stops while the host is suspended, so a single long timer would fire
+	// late after a resume.
+	defer timePhase("wait")()
+	showCountdown := isTerminal(os.Stdout)
+	abortFile := abortFilePath()
+	deadline = deadline.Round(0) // Drop the monotonic reading to compare wall-clock times.
+	defer removeStatusFile()
+
+	for {
+		remaining := deadline.Sub(clock.Now().Round(0))
+		if remaining <= 0 {
+			if showCountdown {
+				printLine()
+			}
+			return true, ""
+		}
+		writeStatusFile(action, phase, deadline, remaining)
+		if showCountdown {
+			color := colorYellow
+			if remaining <= urgentCountdown {
+				color = colorRed
+			}
+			printf("\r%s ", colorize(color, fmt.Sprintf("%s in %s...", action, formatCountdown(remaining))))
+		}
+
+		wait := remaining
+		if wait > waitTick {
+			wait = waitTick
+		}
+		select {
+		case <-ctx.Done():
+			if showCountdown {
+				printLine()
+			}
+			return false, "signal"
+		case <-reloadSignals:
+			reloadConfig()
+		case <-clock.After(wait):
+			if abortFileFound(abortFile) {
+				if showCountdown {
+					printLine()
+				}
+				return false, "abort file " + abortFile
+			}
+		}
 	}
+}
 
-	if message != "" {
-		sendWallMessage(message)
+func formatCountdown(d time.Duration) string {
+	// Format a remaining duration as MM:SS, or HH:MM:SS for waits of an hour or more.
+	if d < 0 {
+		d = 0
+	}
+	seconds := int(d.Round(time.Second) / time.Second)
+	if seconds >= 3600 {
+		return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
 	}
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
 
-	logVerbose("Executing " + action + " action.")
-	executeSystemCommand(action)
+func ringBell() {
+	// Sound the terminal bell for --bell, only when stdout is a terminal and
+	// never in the middle of JSON output.
+	if *(appFlags[bellIndex].value.(*bool)) && isTerminal(os.Stdout) && !jsonOutput() {
+		fmt.Print("\a")
+	}
 }
 
-func confirmAction() bool {
-	// Prompt the user for confirmation before proceeding with an action.
-	fmt.Println("Are you sure you want to proceed with the action? (y/n)")
-	timer := time.NewTimer(time.Duration(getFlagInt(confirmTimeoutIndex)) * time.Second)
-	responseChan := make(chan string, 1)
+func ringBellEachTick(ctx context.Context) func() {
+	// Ring the bell once per waitTick until the returned function is called or
+	// ctx is done, so that a prompt at a noisy console is not missed.
+	if !*(appFlags[bellIndex].value.(*bool)) {
+		return func() {}
+	}
+	ctx, stop := context.WithCancel(ctx)
 	go func() {
-		reader := bufio.NewReader(os.Stdin)
-		response, _ := reader.ReadString('\n')
-		responseChan <- response
+		for {
+			ringBell()
+			select {
+			case <-ctx.Done():
+				return
+			case <-clock.After(waitTick):
+			}
+		}
 	}()
+	return stop
+}
 
-	select {
-	case <-timer.C:
-		fmt.Println("\nConfirmation timer expired, proceeding with action.")
-		return true
-	case response := <-responseChan:
+func parseWarnAt(s string) ([]time.Duration, error) {
+	// Parse a comma-separated list of positive durations such as "30m,10m,1m".
+	var checkpoints []time.Duration
+	for _, field := range strings.Split(s, ",") {
+		checkpoint, err := time.ParseDuration(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("invalid --warn-at: %v", err)
+		}
+		if checkpoint <= 0 {
+			return nil, fmt.Errorf("invalid --warn-at: %q is not positive", strings.TrimSpace(field))
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+	return checkpoints, nil
+}
+
+// warningCheckpoints lists how long before the action repeated warnings are sent.
+var warningCheckpoints = []time.Duration{
+	time.Hour,
+	30 * time.Minute,
+	10 * time.Minute,
+	5 * time.Minute,
+	time.Minute,
+	10 * time.Second,
+}
+
+func planWarnings(total time.Duration, messages []string) ([]time.Duration, error) {
+	// Return the checkpoints at which the message is broadcast again during a
+	// wait of total: those of --warn-at or the default ones that fall within
+	// it. Checkpoints given on the command line must all fit a wait, if there
+	// is one; those from the config file or --category may not. Several messages are paired with the
+	// returned checkpoints in order, and the last one is reused for the rest.
+	// A single message is always allowed, since it is also broadcast when the
+	// action happens; so are several without a wait, which send only the last.
+	checkpoints := warningCheckpoints
+	if warnAt := *(appFlags[warnAtIndex].value.(*string)); warnAt != "" {
+		custom, err := parseWarnAt(warnAt)
+		if err != nil {
+			return nil, err
+		}
+		for _, checkpoint := range custom {
+			if total > 0 && checkpoint >= total && flagGiven(appFlags[warnAtIndex]) {
+				return nil, fmt.Errorf("invalid --warn-at: %s is not within the %s before the action", checkpoint, total.Round(time.Second))
+			}
+		}
+		checkpoints = custom
+	}
+	checkpoints = reboot.CheckpointsWithin(checkpoints, total)
+	if len(messages) > 1 && total > 0 && len(messages) > len(checkpoints) {
+		return nil, fmt.Errorf("more --message values (%d) than warning checkpoints within the wait (%d); give at most one --message per --warn-at checkpoint", len(messages), len(checkpoints))
+	}
+	return checkpoints, nil
+}
+
+// armedWarnings holds the timers of the warnings pending for the current wait,
+// so that a config reload can replace them. window is the length of the wait
+// the checkpoints were planned for.
+var armedWarnings struct {
+	deadline time.Time
+	window   time.Duration
+	timers   []Timer
+}
+
+func armWarnings(deadline time.Time, window time.Duration, checkpoints []time.Duration, messages []string) {
+	// Start a timer for each checkpoint still ahead of the deadline, replacing
+	// the timers armed before. The messages are paired with the checkpoints
+	// within window, so a checkpoint that has already passed keeps its message
+	// from moving on to the next one.
+	for _, timer := range armedWarnings.timers {
 		timer.Stop()
-		return response[0] == 'y' || response[0] == 'Y'
+	}
+	armedWarnings.deadline = deadline
+	armedWarnings.window = window
+	armedWarnings.timers = nil
+
+	dryRun := *(appFlags[dryRunIndex].value.(*bool))
+	total := deadline.Sub(clock.Now())
+	for _, warning := range reboot.Warnings(checkpoints, window, messages) {
+		if warning.Before >= total {
+			continue
+		}
+		warning := warning
+		armedWarnings.timers = append(armedWarnings.timers, clock.AfterFunc(total-warning.Before, func() {
+			reloadLock.Lock()
+			defer reloadLock.Unlock()
+			logVerbose("Sending warning " + warning.Before.String() + " before the action.")
+			broadcastMessage(formatWarning(warning.Message, warning.Before.String()), dryRun)
+		}))
 	}
 }
 
-func executeSystemCommand(action string) {
-	// Execute the system command associated with the specified action.
-	var cmd *exec.Cmd
+func getHostname() string {
+	// Return the system hostname, or "unknown" if it cannot be determined.
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return "unknown"
+	}
+	return hostname
+}
 
-	switch runtime.GOOS {
-	case "linux":
-		cmd = exec.Command("systemctl", action)
-	case "windows":
-		if action == "reboot" {
-			cmd = exec.Command("shutdown", "/r", "/t", "0")
-		} else if action == "poweroff" {
-			cmd = exec.Command("shutdown", "/s", "/t", "0")
-		}
-	case "darwin":
-		if action == "reboot" {
-			cmd = exec.Command("sudo", "shutdown", "-r", "now")
-		} else if action == "poweroff" {
-			cmd = exec.Command("sudo", "shutdown", "-h", "now")
-		} else if action == "halt" {
-			cmd = exec.Command("sudo", "halt")
+func composeMessage() string {
+	// Return the message broadcast when the action happens: the last --message,
+	// which is also the most urgent of a sequence.
+	messages := composeMessages()
+	if len(messages) == 0 {
+		return ""
+	}
+	return messages[len(messages)-1]
+}
+
+func composeMessages() []string {
+	// Return the --message values, leaving out empty ones. They are kept raw so
+	// that only the operator's text is a template; formatWarning adds the
+	// reason and host label once the template has been filled in.
+	var messages []string
+	for _, raw := range *(appFlags[messageIndex].value.(*stringList)) {
+		if raw != "" {
+			messages = append(messages, raw)
 		}
-	default:
-		logger.Printf("Unsupported action or OS: %s on %s", action, runtime.GOOS)
+	}
+	return messages
+}
+
+func decorateMessage(raw string) string {
+	// Add the reason and, with --tag-message, the host label to one message.
+	message := messageWithReason(raw, *(appFlags[reasonIndex].value.(*string)))
+	if message == "" || !*(appFlags[tagMessageIndex].value.(*bool)) {
+		return message
+	}
+	label := getHostname()
+	if tag := *(appFlags[tagIndex].value.(*string)); tag != "" {
+		label += " " + tag
+	}
+	return "[" + label + "] " + message
+}
+
+func messageWithReason(message string, reason string) string {
+	// Append the reason for the action to a non-empty broadcast message.
+	if message == "" || reason == "" {
+		return message
+	}
+	return message + " (Reason: " + reason + ")"
+}
+
+func formatWarning(message string, remaining string) string {
+	// Fill in a message template, substitute the remaining time for a %s
+	// placeholder and decorate the result with the reason and host label, which
+	// are never read as part of the template. Templates are checked at startup,
+	// so a failure here only replaces the message with a plain one instead of
+	// sending broken text.
+	rendered, err := renderMessage(message, remaining)
+	if err != nil {
+		logger.Errorf("Failed to render message: %v\n", err)
+		rendered = "The system will " + messageSchedule.action + " in %s."
+	}
+	return decorateMessage(strings.ReplaceAll(rendered, "%s", remaining))
+}
+
+// messageData holds the fields a --message template such as
+// "Host {{.Host}} reboots at {{.Time}}" can refer to.
+type messageData struct {
+	Host   string // Hostname of the machine.
+	Action string // Action being performed.
+	Time   string // Moment the action is due, as HH:MM, with the date if not today.
+	Delay  string // Time remaining until the action, as for the %s placeholder.
+	Reason string // Value of --reason.
+}
+
+// messageSchedule records the action and the moment it is due for message
+// templates, once they are known.
+var messageSchedule struct {
+	action string
+	at     time.Time
+}
+
+func setMessageSchedule(action string, at time.Time) {
+	// Make the action and its due time available to message templates.
+	messageSchedule.action = action
+	messageSchedule.at = at
+}
+
+func renderMessage(message string, remaining string) (string, error) {
+	// Run a message containing template actions through text/template; other
+	// messages are returned untouched.
+	if !strings.Contains(message, "{{") {
+		return message, nil
+	}
+	tmpl, err := template.New("message").Parse(message)
+	if err != nil {
+		return "", err
+	}
+	now := scheduleNow()
+	at := messageSchedule.at
+	if at.IsZero() {
+		at = now
+	}
+	data := messageData{
+		Host:   getHostname(),
+		Action: messageSchedule.action,
+		Time:   formatScheduleTime(at.In(now.Location()), now),
+		Delay:  remaining,
+		Reason: *(appFlags[reasonIndex].value.(*string)),
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func checkMessageTemplate() error {
+	// Report a message template that cannot be parsed or refers to an unknown
+	// field before anything is scheduled.
+	for _, message := range composeMessages() {
+		if _, err := renderMessage(message, "0s"); err != nil {
+			return usageError{fmt.Errorf("invalid message template: %v", err)}
+		}
+	}
+	return nil
+}
+
+// messageChannels lists the ways a message reaches users, each enabled by a flag.
+var messageChannels = []struct {
+	flag int                               // Index of the flag enabling the channel.
+	send func(message string, dryRun bool) // Delivers the message.
+}{
+	{wallIndex, sendWallMessage},
+	{notifyIndex, sendDesktopNotification},
+}
+
+func broadcastMessage(message string, dryRun bool) {
+	// Deliver the message through every enabled channel: terminals and the
+	// desktop session by default.
+	defer timePhase("notification")()
+	sent := false
+	for _, channel := range messageChannels {
+		if *(appFlags[channel.flag].value.(*bool)) {
+			channel.send(message, dryRun)
+			sent = true
+		}
+	}
+	if !sent {
+		logVerbose("All message channels are disabled, not broadcasting the message.")
+	}
+}
+
+func sendDesktopNotification(message string, dryRun bool) {
+	// Show a desktop notification using notify-send (Linux) or osascript (macOS).
+	argv := reboot.NotifyCommand(runtime.GOOS, appName, message)
+	if argv == nil {
+		logVerbose("Desktop notifications are not supported on this OS.")
+		return
+	}
+	cmd := exec.Command(argv[0], argv[1:]...)
+
+	// Headless machines usually lack a notification tool, which is not an error.
+	if _, err := exec.LookPath(cmd.Args[0]); err != nil {
+		logVerbose(cmd.Args[0] + " not found, skipping desktop notification.")
 		return
 	}
 
+	logVerbose("Sending desktop notification.")
+	if dryRun {
+		printDryRun(cmd)
+		return
+	}
 	if err := cmd.Run(); err != nil {
-		logger.Printf("Failed to execute %s: %v\n", action, err)
-	} else {
-		logger.Printf("%s action executed successfully.\n", action)
+		logVerbose("Failed to send desktop notification: " + err.Error())
 	}
 }
 
-func getFlagInt(index int) int {
-	// Retrieve an integer value from the appFlags based on the index.
-	return *(appFlags[index].value.(*int))
-}
+func sendWallMessage(message string, dryRun bool) {
+	// Send a message to all users on the system using the OS broadcast command,
+	// or only to the users given with --notify-user.
+	if users := *(appFlags[notifyUserIndex].value.(*stringList)); len(users) > 0 {
+		for _, user := range users {
+			logVerbose("Sending message to " + user + ".")
+			if err := sendUserMessage(user, message, dryRun); err != nil {
+				logger.Errorf("Failed to send message to %s: %v\n", user, err)
+			}
+		}
+		return
+	}
+
+	message = reboot.SanitizeMessage(message)
+	argv := reboot.WallCommand(runtime.GOOS, message)
+	if argv == nil {
+		if *(appFlags[verboseIndex].value.(*bool)) {
+			logger.Info("Wall message feature is not supported on this OS.")
+		}
+		return
+	}
 
-func logVerbose(message string) {
-	// Log a message if verbose output is enabled.
 	if *(appFlags[verboseIndex].value.(*bool)) {
-		logger.Println(message)
+		logger.Info("Sending wall message.")
+	}
+
+	// Minimal installs may lack wall; reach the desktop instead, unless the
+	// desktop notification channel is on and gets the message anyway.
+	if _, err := exec.LookPath(argv[0]); err != nil {
+		logVerbose(argv[0] + " not installed, skipping broadcast.")
+		if !*(appFlags[notifyIndex].value.(*bool)) {
+			sendDesktopNotification(message, dryRun)
+		}
+		return
+	}
+	if dryRun {
+		printDryRun(exec.Command(argv[0], argv[1:]...))
+		return
+	}
+	if err := reboot.Broadcast(message, nil); err != nil {
+		logger.Errorf("Failed to send wall message: %v\n", err)
 	}
 }
 
-func main() {
-	// Parse the command-line flags.
-	flag.Parse()
+func executeAction(ctx context.Context, action string, message string, confirmation bool, dryRun bool) error {
+	// Perform the requested action after optional confirmation and message
+	// broadcasting, unless ctx is cancelled first.
+	if err := checkInhibitors(action); err != nil {
+		return err
+	}
+	if confirmation && !confirmAction(ctx, getConfirmOptions()) {
+		printLine("Action cancelled.")
+		logger.Info("Action cancelled by user.")
+		return errCancelled
+	}
 
-	// Display version information if the version flag is set and exit.
-	if *appFlags[versionIndex].value.(*bool) {
-		fmt.Printf("%s version %s\n", appName, appVersion)
-		os.Exit(0)
+	if message != "" {
+		broadcastMessage(formatWarning(message, "0s"), dryRun)
 	}
 
-	// Determine the action to take based on flags provided by the user.
-	action := "reboot" // Default action is to reboot.
-	if *(appFlags[haltIndex].value.(*bool)) {
-		action = "halt"
-	} else if *(appFlags[poweroffIndex].value.(*bool)) || *(appFlags[shutdownIndex].value.(*bool)) { // Modified line
-		action = "poweroff"
+	endHooks := timePhase("hooks")
+	err := runPreHooks(ctx, action, dryRun)
+	endHooks()
+	if err != nil {
+		return fmt.Errorf("%v; action aborted", err)
 	}
 
-	// Handle scheduled time if provided.
-	if *(appFlags[timeIndex].value.(*string)) != "" {
-		handleScheduledTime(*(appFlags[timeIndex].value.(*string)), action)
-		return
+	reason := *(appFlags[reasonIndex].value.(*string))
+	if url := *(appFlags[webhookIndex].value.(*string)); url != "" {
+		endWebhook := timePhase("notification")
+		err := sendWebhook(url, action, reason, dryRun)
+		endWebhook()
+		if err != nil {
+			if *(appFlags[webhookRequiredIndex].value.(*bool)) {
+				return fmt.Errorf("%v; action aborted", err)
+			}
+			logger.Errorf("Failed to notify webhook: %v\n", err)
+		}
 	}
 
-	// Proceed with a delayed action if a delay is specified.
-	handleDelay(*(appFlags[delayIndex].value.(*int)), action)
+	if window := time.Duration(getFlagInt(cancelWindowIndex)) * time.Second; window > 0 && !waitForAbort(ctx, action, window) {
+		printLine("Action cancelled.")
+		logger.Info("Action cancelled during the cancel window.")
+		return errCancelled
+	}
+
+	logAudit(action, "executing")
+	if ctx.Err() != nil {
+		printLine("Action cancelled.")
+		logger.Info("Action cancelled by signal.")
+		return errCancelled
+	}
+	prepareWake(action, *(appFlags[wakeAtIndex].value.(*string)), dryRun)
+	if !dryRun {
+		recordLastAction(action, reason, clock.Now())
+		recordPendingBoot(action, reason)
+	}
+	preparePersistence(ctx, action, dryRun)
+	ringBell()
+	releaseActionLock()
+
+	// A real reboot may never return, so its timing is logged up front.
+	if !dryRun {
+		logPhaseTimings("before the command")
+	}
+	endCommand := timePhase("command")
+	err = executeSystemCommand(ctx, action, dryRun)
+	endCommand()
+	if dryRun {
+		logPhaseTimings("dry run")
+	}
+	if err != nil {
+		if !dryRun {
+			clearPendingBoot()
+		}
+		return err
+	}
+	return nil
 }
 
-// handleScheduledTime schedules an action at a specific time.
-func handleScheduledTime(timeStr, action string) {
-	message := *(appFlags[messageIndex].value.(*string))
-	confirmation := *(appFlags[confirmIndex].value.(*bool))
+func waitForAbort(ctx context.Context, action string, window time.Duration) bool {
+	// Give the user a last chance to abort the action by pressing Enter (or by
+	// cancelling ctx) before it runs. Returns true if the action should proceed.
+	if !isTerminal(os.Stdin) {
+		logger.Info("Skipping the cancel window: stdin is not a terminal.")
+		return true
+	}
 
-	// Attempt to schedule and handle errors if any.
-	if err := scheduleAtSpecificTime(timeStr, action, message, confirmation); err != nil {
-		logger.Printf("Error scheduling action: %v\n", err)
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	ctx, abort := context.WithCancel(ctx)
+	defer abort()
+	go func() {
+		// Only a full line counts as a keypress; EOF or a read error means
+		// nobody can answer, so the window is simply waited out.
+		if _, err := bufio.NewReader(os.Stdin).ReadString('\n'); err == nil {
+			abort()
+		}
+	}()
+
+	// Like the confirmation prompt, the instructions are shown even with --quiet.
+	fmt.Println(colorize(colorBold+colorRed, fmt.Sprintf("%s in %s; press Enter to abort.", action, window)))
+	logger.Infof("Waiting %s for the %s to be aborted.\n", window, action)
+	defer ringBellEachTick(ctx)()
+	completed, _ := waitWithCountdown(ctx, action, phaseCancelWindow, clock.Now().Add(window))
+	return completed
+}
+
+func abortFilePath() string {
+	// Use the file given with --abort-file, or "abort" next to the config file.
+	if path := *(appFlags[abortFileIndex].value.(*string)); path != "" {
+		return path
 	}
+	return filepath.Join(filepath.Dir(getConfigFilePath()), "abort")
 }
 
-// handleDelay sets a delay before executing an action.
-func handleDelay(delay int, action string) {
-	message := *(appFlags[messageIndex].value.(*string))
-	confirmation := *(appFlags[confirmIndex].value.(*bool))
+func abortFileFound(path string) bool {
+	// Report whether the abort file exists, removing it so that it only cancels
+	// one action.
+	if _, err := os.Stat(path); err != nil {
+		return false
+	}
+	logger.Infof("Abort file %s found.\n", path)
+	if err := os.Remove(path); err != nil {
+		logger.Errorf("Failed to remove abort file: %v\n", err)
+	}
+	return true
+}
 
-	// Log and wait if a delay is set, then execute the action.
-	if delay > 0 {
-		logger.Printf("%s scheduled in %d minutes.\n", action, delay)
-		fmt.Printf("%s scheduled in %d minutes.\n", action, delay)
-		time.Sleep(time.Duration(delay) * time.Minute)
+func loadMessageFile() error {
+	// Replace the message with the contents of --message-file, if given. A
+	// message given on the command line as well is ambiguous.
+	path := *(appFlags[messageFileIndex].value.(*string))
+	if path == "" {
+		return nil
+	}
+	if flagGiven(appFlags[messageIndex]) {
+		return usageError{errors.New("--message and --message-file cannot be used together")}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return usageError{fmt.Errorf("reading message file: %v", err)}
+	}
+	*(appFlags[messageIndex].value.(*stringList)) = stringList{strings.TrimRight(string(data), "\r\n")}
+	return nil
+}
+
+func sendNotificationsOnly(action string) error {
+	// Broadcast the message and notify the webhook as if the action were coming,
+	// without performing it. A %s in the message is replaced by the delay or time
+	// given, if any.
+	if composeMessage() == "" {
+		return usageError{errors.New("--notify-only requires --message")}
+	}
+	dryRun := *(appFlags[dryRunIndex].value.(*bool))
+	delay := plannedDelay()
+	setMessageSchedule(action, clock.Now().Add(delay))
+	broadcastMessage(formatWarning(composeMessage(), delay.Round(time.Second).String()), dryRun)
+
+	if url := *(appFlags[webhookIndex].value.(*string)); url != "" {
+		if err := sendWebhook(url, action, *(appFlags[reasonIndex].value.(*string)), dryRun); err != nil {
+			return err
+		}
+	}
+	logger.Infof("Sent notifications for %s without performing it.\n", action)
+	emitStatus(newStatusReport(action, "notified"))
+	return nil
+}
+
+func plannedDelay() time.Duration {
+	// Work out how far away the action was asked to be from --date, --time,
+	// --wait or --delay, ignoring values that do not parse.
+	now := scheduleNow()
+	if timeStr := *(appFlags[timeIndex].value.(*string)); timeStr != "" {
+		if at, err := reboot.ParseTime(*(appFlags[dateIndex].value.(*string)), timeStr, now); err == nil {
+			return at.Sub(now)
+		}
+		return 0
 	}
+	if wait := *(appFlags[waitIndex].value.(*string)); wait != "" {
+		d, _ := parseDelay(wait)
+		return d
+	}
+	return time.Duration(getFlagInt(delayIndex)) * time.Minute
+}
+
+func runPreHooks(ctx context.Context, action string, dryRun bool) error {
+	// Run each pre-hook in order with the action name as its argument. A failing
+	// hook stops the action unless hook errors are ignored.
+	timeout := time.Duration(getFlagInt(hookTimeoutIndex)) * time.Second
+	ignoreErrors := *(appFlags[ignoreHookErrorsIndex].value.(*bool))
+
+	for _, hook := range *(appFlags[preHookIndex].value.(*stringList)) {
+		hookCtx, cancel := context.WithTimeout(ctx, timeout)
+		cmd := exec.CommandContext(hookCtx, hook, action)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		if dryRun {
+			printDryRun(cmd)
+			cancel()
+			continue
+		}
+
+		logVerbose("Running pre-hook " + hook + ".")
+		err := cmd.Run()
+		if hookCtx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s", timeout)
+		}
+		cancel()
+
+		if err != nil {
+			if !ignoreErrors {
+				return fmt.Errorf("pre-hook %s failed: %v", hook, err)
+			}
+			logger.Errorf("Pre-hook %s failed, continuing: %v\n", hook, err)
+			continue
+		}
+		logger.Infof("Pre-hook %s completed.\n", hook)
+	}
+	return nil
+}
+
+func getConfirmOptions() confirmOptions {
+	// Build the confirmation options from the command-line flags.
+	opts := confirmOptions{
+		timeout:          time.Duration(getFlagInt(confirmTimeoutIndex)) * time.Second,
+		proceedOnTimeout: *(appFlags[confirmDefaultIndex].value.(*string)) == "proceed",
+		phrase:           *(appFlags[confirmPhraseIndex].value.(*string)),
+	}
+	// A required phrase raises the bar, so an unanswered prompt aborts unless
+	// --confirm-default was given explicitly.
+	if opts.phrase != "" && !flagGiven(appFlags[confirmDefaultIndex]) {
+		opts.proceedOnTimeout = false
+	}
+	if *(appFlags[noTimeoutIndex].value.(*bool)) {
+		opts.timeout = 0
+	}
+	return opts
+}
+
+// Values of --confirm-when.
+const (
+	confirmAtEnd   = "end"
+	confirmAtStart = "start"
+)
+
+func confirmBeforeWait(ctx context.Context, confirmation bool) (bool, error) {
+	// With --confirm-when start, the default, ask before a delayed or scheduled
+	// action starts waiting; with end, leave it to executeAction right before
+	// the action runs. Returns whether executeAction still has to ask.
+	if !confirmation || *(appFlags[confirmWhenIndex].value.(*string)) != confirmAtStart {
+		return confirmation, nil
+	}
+	if !confirmAction(ctx, getConfirmOptions()) {
+		printLine("Action cancelled.")
+		logger.Info("Action cancelled by user.")
+		return false, errCancelled
+	}
+	return false, nil
+}
+
+func confirmAction(ctx context.Context, opts confirmOptions) bool {
+	// Prompt the user for confirmation before proceeding with an action. An
+	// answer in $SYSREBOOT_CONFIRM is used without prompting; without one, the
+	// action is aborted when there is no terminal to ask on.
+	defer timePhase("confirmation")()
+	if answer := os.Getenv(confirmEnvVar); answer != "" {
+		confirmed := opts.accepts(answer)
+		logger.Infof("Confirmation answered by %s=%s (proceed: %t).\n", confirmEnvVar, answer, confirmed)
+		return confirmed
+	}
+	if !isTerminal(os.Stdin) {
+		logger.Errorf("Cannot ask for confirmation: stdin is not a terminal and %s is not set.\n", confirmEnvVar)
+		fmt.Fprintf(os.Stderr, "Error: cannot ask for confirmation: stdin is not a terminal; set %s=%s to confirm non-interactively.\n", confirmEnvVar, confirmText.responses[len(confirmText.responses)-1])
+		return false
+	}
+
+	// The prompt is shown even with --quiet since an answer is expected.
+	if opts.phrase != "" {
+		fmt.Println(colorize(colorBold+colorYellow, strings.Replace(confirmText.phrasePrompt, "%s", strconv.Quote(opts.phrase), 1)))
+	} else {
+		fmt.Println(colorize(colorBold+colorYellow, confirmText.prompt))
+	}
+	responseChan := make(chan bool, 1)
+	go func() {
+		responseChan <- readConfirmation(os.Stdin, opts)
+	}()
+	defer ringBellEachTick(ctx)()
+
+	// A nil channel never fires, so without a timeout the prompt blocks until answered.
+	var expired <-chan time.Time
+	if opts.timeout > 0 {
+		expired = clock.After(opts.timeout)
+	}
+
+	select {
+	case <-expired:
+		if opts.proceedOnTimeout {
+			printLine("\nConfirmation timer expired, proceeding with action.")
+			return true
+		}
+		printLine("\nConfirmation timer expired, aborting action.")
+		return false
+	case confirmed := <-responseChan:
+		return confirmed
+	case <-ctx.Done():
+		printLine()
+		return false
+	}
+}
+
+func readConfirmation(r io.Reader, opts confirmOptions) bool {
+	// Read one line of input and report whether it confirms the action.
+	// Empty input and a closed reader count as "no".
+	response, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false
+	}
+	return opts.accepts(response)
+}
+
+func isAffirmative(response string) bool {
+	// Accept any of the configured responses (y or yes by default) in any
+	// case, ignoring surrounding whitespace.
+	response = strings.TrimSpace(response)
+	for _, token := range confirmText.responses {
+		if strings.EqualFold(response, token) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkActionSupported(action string) error {
+	// Reject actions this OS cannot perform before anything is scheduled.
+	argv, _, err := systemCommand(action)
+	if err != nil {
+		return usageError{err}
+	}
+	if argv == nil {
+		return usageError{fmt.Errorf("%s is not supported on %s", action, runtime.GOOS)}
+	}
+	return nil
+}
+
+func executeSystemCommand(ctx context.Context, action string, dryRun bool) error {
+	// Execute the system command associated with the specified action.
+	argv, fallback, err := systemCommand(action)
+	if err != nil {
+		return &reboot.ActionError{Action: action, OS: runtime.GOOS, Stage: reboot.StageCommand, Err: err}
+	}
+
+	// Not every OS knows every action; never run a command that was not chosen.
+	if argv == nil {
+		logger.Errorf("Unsupported action %s on OS %s.\n", action, runtime.GOOS)
+		return &reboot.ActionError{Action: action, OS: runtime.GOOS, Stage: reboot.StageCommand, Err: errors.New("unsupported action")}
+	}
+
+	if fallback != "" {
+		logger.Infof("Falling back to a full reboot: %s.\n", fallback)
+		printf("Warning: falling back to a full reboot: %s.\n", fallback)
+	}
+
+	if err := simulatedFailure(action); err != nil {
+		return err
+	}
+
+	if dryRun {
+		printDryRun(exec.Command(argv[0], argv[1:]...))
+		return nil
+	}
+
+	// Bound how long a hanging command can block us, and give a command that
+	// fails transiently (e.g. while D-Bus is not ready) a few more chances.
+	timeout := time.Duration(getFlagInt(commandTimeoutIndex)) * time.Second
+	retries := getFlagInt(retryIndex)
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		err = reboot.Execute(ctx, reboot.Options{Action: action, Command: argv, Timeout: timeout, Runner: systemCommandRunner})
+		if err == nil {
+			break
+		}
+		var ae *reboot.ActionError
+		if errors.As(err, &ae) && ae.Stage == reboot.StageTimeout {
+			logger.Errorf("%s command timed out after %s and was killed.\n", action, timeout)
+		}
+		if attempt >= retries || ctx.Err() != nil {
+			return err
+		}
+		logger.Errorf("Attempt %d of %d failed: %v; retrying in %s.\n", attempt+1, retries+1, err, backoff)
+		printf("Attempt %d of %d failed, retrying in %s.\n", attempt+1, retries+1, backoff)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-clock.After(backoff):
+		}
+		backoff *= 2
+	}
+	logger.Infof("%s action executed successfully.\n", action)
+	return nil
+}
+
+// retryBackoff is the wait before the first --retry attempt; it doubles after each one.
+const retryBackoff = 2 * time.Second
+
+func checkSystemCommand(action string) error {
+	// Make sure the command performing the action can be found, so that a
+	// missing binary is reported now rather than at the end of a long delay.
+	argv, _, err := systemCommand(action)
+	if err != nil {
+		return err
+	}
+	if argv == nil {
+		return fmt.Errorf("unsupported action %s on OS %s", action, runtime.GOOS)
+	}
+	if _, err := exec.LookPath(argv[0]); err != nil {
+		return fmt.Errorf("cannot %s: %v", action, err)
+	}
+	return nil
+}
+
+func systemCommand(action string) ([]string, string, error) {
+	// Return the command line performing the action, preferring a command
+	// configured in the config file over the OS default, whose binary may be
+	// replaced with --shutdown-bin. The result is nil if this OS has no way to
+	// perform the action. When --kexec was requested but cannot be used, the
+	// second result explains why a full reboot is done instead.
+	if argv, ok := commandOverrides[action]; ok {
+		return argv, "", nil
+	}
+	var fallback string
+	if kexecRequested(action) {
+		argv, err := kexecCommand()
+		if err == nil {
+			return argv, "", nil
+		}
+		fallback = err.Error()
+	}
+
+	argv, err := reboot.DefaultCommand(action)
+	if bin := *(appFlags[shutdownBinIndex].value.(*string)); bin != "" && argv != nil {
+		// Keep sudo in front of the replacement binary where the OS needs it.
+		argv = append([]string(nil), argv...)
+		if argv[0] == "sudo" && len(argv) > 1 {
+			argv[1] = bin
+		} else {
+			argv[0] = bin
+		}
+	}
+	return argv, fallback, err
+}
+
+func printDryRun(cmd *exec.Cmd) {
+	// Report the command that would have been run on this OS without running it.
+	line := fmt.Sprintf("Dry run (%s): would execute: %s", runtime.GOOS, shellJoin(cmd.Args))
+	logger.Info(line)
+	printLine(line)
+}
+
+func shellJoin(args []string) string {
+	// Join command arguments into a string that can be pasted into a POSIX shell.
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=+,@%") == "" {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+func rebootRequired() bool {
+	// Report whether installed updates are waiting for a reboot (Linux only).
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	_, err := os.Stat(rebootRequiredFile)
+	return err == nil
+}
+
+// containerMarkers are files that container runtimes create inside containers.
+var containerMarkers = []string{"/.dockerenv", "/run/.containerenv"}
+
+func isContainer() bool {
+	// Report whether sysreboot runs inside a container, where systemctl and
+	// shutdown either fail or act on the host (Linux only).
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	if os.Getenv("container") != "" {
+		return true
+	}
+	for _, marker := range containerMarkers {
+		if _, err := os.Stat(marker); err == nil {
+			return true
+		}
+	}
+	data, err := os.ReadFile("/proc/1/cgroup")
+	if err != nil {
+		return false
+	}
+	for _, hint := range []string{"docker", "kubepods", "containerd", "lxc", "libpod"} {
+		if strings.Contains(string(data), hint) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkContainer(action string, dryRun bool) error {
+	// Refuse to run the OS command inside a container unless a command for the
+	// action was configured for it, or --force insists.
+	if _, ok := commandOverrides[action]; ok || !isContainer() {
+		return nil
+	}
+	hint := "set " + action + commandOverrideSuffix + " in the config file to a command that suits the container, or use --force"
+	if dryRun {
+		logger.Infof("Dry run: running inside a container; %s.\n", hint)
+		printf("Dry run: running inside a container; %s.\n", hint)
+		return nil
+	}
+	logger.Errorf("Refusing to %s inside a container.\n", action)
+	return fmt.Errorf("refusing to %s inside a container; %s", action, hint)
+}
+
+func uptime() (time.Duration, error) {
+	// Report how long the system has been running.
+	switch runtime.GOOS {
+	case "linux":
+		data, err := os.ReadFile("/proc/uptime")
+		if err != nil {
+			return 0, err
+		}
+		fields := strings.Fields(string(data))
+		if len(fields) == 0 {
+			return 0, errors.New("unexpected /proc/uptime format")
+		}
+		seconds, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return 0, fmt.Errorf("unexpected /proc/uptime format: %v", err)
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	case "windows":
+		return windowsUptime()
+	case "darwin", "freebsd", "openbsd", "netbsd":
+		output, err := exec.Command("sysctl", "-n", "kern.boottime").Output()
+		if err != nil {
+			return 0, fmt.Errorf("reading kern.boottime: %v", err)
+		}
+		bootTime, err := parseBootTime(string(output))
+		if err != nil {
+			return 0, err
+		}
+		return time.Since(bootTime), nil
+	default:
+		return 0, fmt.Errorf("uptime is not supported on %s", runtime.GOOS)
+	}
+}
+
+func parseBootTime(output string) (time.Time, error) {
+	// Parse kern.boottime, which is either "{ sec = 1700000000, usec = 0 } ..."
+	// (darwin, FreeBSD) or a plain epoch value (OpenBSD, NetBSD).
+	output = strings.TrimSpace(output)
+	if i := strings.Index(output, "sec = "); i >= 0 {
+		output = output[i+len("sec = "):]
+		if end := strings.IndexAny(output, ", }"); end >= 0 {
+			output = output[:end]
+		}
+	}
+	seconds, err := strconv.ParseInt(output, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unexpected kern.boottime format: %q", output)
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+func parseDurationWithDays(s string) (time.Duration, error) {
+	// Parse a duration that may start with a number of days, e.g. "7d" or "1d12h".
+	var days time.Duration
+	if before, after, found := strings.Cut(s, "d"); found {
+		n, err := strconv.Atoi(before)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number of days in %q", s)
+		}
+		days = time.Duration(n) * 24 * time.Hour
+		if after == "" {
+			return days, nil
+		}
+		s = after
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	return days + d, nil
+}
+
+func hasSufficientPrivileges() (bool, error) {
+	// Check whether the current user is allowed to reboot or power off the machine.
+	switch runtime.GOOS {
+	case "windows":
+		return isElevated()
+	case "darwin", "freebsd", "openbsd", "netbsd":
+		// These commands are run through sudo, so non-interactive sudo is sufficient.
+		if effectiveUID() == 0 {
+			return true, nil
+		}
+		return exec.Command("sudo", "-n", "true").Run() == nil, nil
+	default:
+		return effectiveUID() == 0, nil
+	}
+}
+
+func checkPrivileges(action string, dryRun bool) {
+	// Exit early with an actionable error if the action is bound to fail for lack of privileges.
+	if !needsPrivileges(action) {
+		return
+	}
+	ok, err := hasSufficientPrivileges()
+	if err != nil {
+		logger.Errorf("Failed to determine privileges: %v\n", err)
+	}
+	if ok {
+		return
+	}
+
+	hint := privilegeHint()
+	if dryRun {
+		logger.Infof("Dry run: insufficient privileges to %s; %s.\n", action, hint)
+		printf("Dry run: insufficient privileges to %s; %s.\n", action, hint)
+		return
+	}
+	logger.Errorf("Insufficient privileges to %s.\n", action)
+	fmt.Fprintf(os.Stderr, "Error: insufficient privileges to %s; %s.\n", action, hint)
+	os.Exit(exitFailure)
+}
+
+func needsPrivileges(action string) bool {
+	// Report whether the action requires root or Administrator rights. The
+	// logged-in user may put the machine to sleep on Linux (through polkit),
+	// macOS and Windows.
+	if action == "suspend" || action == "hibernate" {
+		return runtime.GOOS == "freebsd" || runtime.GOOS == "openbsd" || runtime.GOOS == "netbsd"
+	}
+	return true
+}
+
+func privilegeHint() string {
+	// Tell the user how to obtain the privileges an action needs on this OS.
+	if runtime.GOOS == "windows" {
+		return "run it from an elevated (Administrator) prompt"
+	}
+	return "run it as root or with sudo"
+}
+
+// actionFlags maps the boolean action flags to the action they select.
+var actionFlags = map[int]string{haltIndex: "halt", hibernateIndex: "hibernate", poweroffIndex: "poweroff", shutdownIndex: "poweroff", rebootIndex: "reboot", suspendIndex: "suspend"}
+
+// resolveAction determines the action to perform. Action flags given on the
+// command line win over those set in the config file, and reboot is used when
+// neither selects anything. Selecting more than one action from the same
+// source is a usage error rather than being settled by precedence.
+func resolveAction() (string, error) {
+	// Collect the actions requested on the command line, keyed by action.
+	explicit := make(map[string][]string)
+	var err error
+	flag.Visit(func(f *flag.Flag) {
+		for _, fd := range appFlags {
+			if f.Name != fd.longName && f.Name != fd.shortName {
+				continue
+			}
+			if action, ok, actionErr := actionFlagValue(fd); actionErr != nil {
+				err = actionErr
+			} else if ok {
+				explicit[action] = append(explicit[action], "--"+fd.longName)
+			}
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	if action, err := singleAction(explicit, "conflicting action flags"); action != "" || err != nil {
+		return action, err
+	}
+
+	// Fall back to actions set in the config file.
+	configured := make(map[string][]string)
+	for _, fd := range appFlags {
+		action, ok, err := actionFlagValue(fd)
+		if err != nil {
+			return "", err
+		} else if ok {
+			configured[action] = append(configured[action], fd.longName)
+		}
+	}
+	if action, err := singleAction(configured, "conflicting actions in config file"); action != "" || err != nil {
+		return action, err
+	}
+	return "reboot", nil
+}
+
+func actionFlagValue(fd flagData) (string, bool, error) {
+	// Report the action selected by a flag, if it is an action flag that is set.
+	if fd.longName == appFlags[actionIndex].longName {
+		value := *(fd.value.(*string))
+		if value == "" {
+			return "", false, nil
+		}
+		action, err := reboot.ParseAction(value)
+		if err != nil {
+			return "", false, usageError{fmt.Errorf("invalid --action %q (expected %s)", value, strings.Join(reboot.Actions, ", "))}
+		}
+		return action, true, nil
+	}
+	for index, action := range actionFlags {
+		if appFlags[index].longName == fd.longName && *(fd.value.(*bool)) {
+			return action, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func singleAction(requested map[string][]string, conflict string) (string, error) {
+	// Return the only requested action, or an error naming the flags that conflict.
+	if len(requested) > 1 {
+		var names []string
+		for _, flags := range requested {
+			names = append(names, flags...)
+		}
+		sort.Strings(names)
+		return "", usageError{fmt.Errorf("%s: %s", conflict, strings.Join(names, ", "))}
+	}
+	for action := range requested {
+		return action, nil
+	}
+	return "", nil
+}
+
+func exitOnError(err error) {
+	// Report a failure and exit with the code matching its kind.
+	if err == nil {
+		return
+	}
+	code := exitFailure
+	var ue usageError
+	var ae *reboot.ActionError
+	if errors.Is(err, errCancelled) {
+		os.Exit(exitCancelled)
+	} else if errors.As(err, &ue) {
+		code = exitUsage
+	} else if errors.As(err, &ae) && ae.Stage == reboot.StageSchedule {
+		code = exitUsage // An unusable schedule comes from the arguments.
+	}
+	logger.Errorf("Error: %v\n", err)
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	os.Exit(code)
+}
+
+// nowClearedFlags lists the flags that delay or announce an action, which
+// --now turns off unless they were given on the command line. Of those, the
+// ones describing when the action runs cannot be combined with --now at all.
+var nowClearedFlags = []int{confirmIndex, confirmPhraseIndex, dateIndex, delayIndex, graceIndex, jitterIndex, messageIndex, minDelayIndex, timeIndex, waitIndex, warnAtIndex}
+
+func applyNow() error {
+	// Strip the ceremony from the action for --now: no wait, no warnings and
+	// no confirmation, whatever the config file or --category asked for. A
+	// --confirm or --message given alongside --now is still honoured, once.
+	for _, index := range []int{dateIndex, delayIndex, timeIndex, waitIndex} {
+		if flagGiven(appFlags[index]) {
+			return usageError{fmt.Errorf("--now cannot be used with --%s", appFlags[index].longName)}
+		}
+	}
+	for _, index := range nowClearedFlags {
+		fd := appFlags[index]
+		// The message has already been read from a --message-file on the command line.
+		if flagGiven(fd) || (index == messageIndex && flagGiven(appFlags[messageFileIndex])) {
+			continue
+		}
+		switch v := fd.value.(type) {
+		case *bool:
+			*v = false
+		case *int:
+			*v = 0
+		case *string:
+			*v = ""
+		case *stringList:
+			*v = nil
+		}
+	}
+	logger.Info("--now given, performing the action right away.")
+	return nil
+}
+
+func confirmationRequired() bool {
+	// Ask for confirmation when --confirm or --confirm-phrase was given, unless
+	// --force overrides it.
+	requested := *(appFlags[confirmIndex].value.(*bool)) || *(appFlags[confirmPhraseIndex].value.(*string)) != ""
+	return requested && !*(appFlags[forceIndex].value.(*bool))
+}
+
+func getFlagInt(index int) int {
+	// Retrieve an integer value from the appFlags based on the index.
+	return *(appFlags[index].value.(*int))
+}
+
+func printf(format string, args ...interface{}) {
+	// Print informational output for the user unless --quiet is set or stdout
+	// carries JSON status objects.
+	if !*(appFlags[quietIndex].value.(*bool)) && !jsonOutput() {
+		fmt.Printf(format, args...)
+	}
+}
+
+func printLine(args ...interface{}) {
+	// Print a line of informational output for the user unless --quiet is set or
+	// stdout carries JSON status objects.
+	if !*(appFlags[quietIndex].value.(*bool)) && !jsonOutput() {
+		fmt.Println(args...)
+	}
+}
+
+func logEffectiveConfig(action string) {
+	// Log the resolved value of every flag, and where it came from, together with
+	// the action, the OS and the log destination, so bug reports show exactly what
+	// sysreboot was asked to do.
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	logger.Infof("Effective configuration: action=%s os=%s/%s log=%s config=%s\n", action, runtime.GOOS, runtime.GOARCH, logDestination(), getConfigFilePath())
+	for _, fd := range appFlags {
+		value := flagValueString(fd)
+		source := "config file"
+		if explicit[fd.longName] || explicit[fd.shortName] {
+			source = "command line"
+		} else if categorySeeded[fd.longName] {
+			source = "category"
+		} else if flagIsDefault(fd) {
+			source = "default"
+		}
+		logger.Infof("  --%s = %q (%s)\n", fd.longName, value, source)
+	}
+	for _, name := range reboot.Actions {
+		if argv, ok := commandOverrides[name]; ok {
+			logger.Infof("  %s%s = %s (config file)\n", name, commandOverrideSuffix, shellJoin(argv))
+		}
+	}
+}
+
+func flagValueString(fd flagData) string {
+	// Format the current value of a flag.
+	switch v := fd.value.(type) {
+	case *bool:
+		return strconv.FormatBool(*v)
+	case *int:
+		return strconv.Itoa(*v)
+	case *string:
+		return *v
+	case flag.Value:
+		return v.String()
+	}
+	return ""
+}
+
+func flagIsDefault(fd flagData) bool {
+	// Report whether a flag still has its default value, wherever it came from.
+	value := flagValueString(fd)
+	return value == fmt.Sprint(fd.defaultVal) || (fd.defaultVal == nil && value == "")
+}
+
+func logDestination() string {
+	// Describe where log entries are written.
+	target := *(appFlags[logTargetIndex].value.(*string))
+	if target == logTargetStdout {
+		return stdoutLogStream(*(appFlags[outputIndex].value.(*string))).Name()
+	}
+	if logFile == "" {
+		return target
+	}
+	return logFile
+}
+
+func logAudit(action string, event string) {
+	// Record an event of the action together with who asked for it and why,
+	// for the audit trail in the log, the system log or the Windows Event Log.
+	line := fmt.Sprintf("%s %s, requested by %s", action, event, invokingUser())
+	if reason := *(appFlags[reasonIndex].value.(*string)); reason != "" {
+		line += " (reason: " + reason + ")"
+	}
+	logger.Info(line + ".")
+}
+
+func logVerbose(message string) {
+	// Log a message if verbose output is enabled.
+	if *(appFlags[verboseIndex].value.(*bool)) {
+		logger.Info(message)
+	}
+}
+
+func main() {
+	// Parse the command-line flags.
+	startPhaseTimings()
+	flag.Parse()
+
+	// Show the usage for -h and --help. The flag is handled before the config
+	// file is read so that it can never be mistaken for an action.
+	if *(appFlags[helpIndex].value.(*bool)) {
+		flag.Usage()
+		os.Exit(exitSuccess)
+	}
+
+	// Display version information and exit. Like --help, --version works
+	// before anything is read or opened, so a broken config file or an
+	// unwritable log directory cannot get in its way.
+	if *appFlags[versionIndex].value.(*bool) {
+		printVersion()
+		os.Exit(exitSuccess)
+	}
+
+	// Print the config file template, which shows the built-in defaults whatever
+	// the current config file says.
+	if *(appFlags[dumpConfigIndex].value.(*bool)) {
+		dumpConfig(os.Stdout)
+		os.Exit(exitSuccess)
+	}
+
+	// Apply defaults from the config file to flags not given on the command line.
+	configErr := loadConfig()
+
+	// Initialize the logger, preferring the system log when it was requested and
+	// falling back to the log file when it cannot be reached.
+	switch target := *(appFlags[logTargetIndex].value.(*string)); target {
+	case logTargetFile:
+	case logTargetStdout:
+		logger = newAppLogger(stdoutLogStream(*(appFlags[outputIndex].value.(*string))), getHostname(), *(appFlags[tagIndex].value.(*string)))
+	case logTargetSyslog, logTargetEventLog:
+		open := openSyslog
+		if target == logTargetEventLog {
+			open = openEventLog
+		}
+		if sys, err := open(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: cannot use %s, logging to file instead: %v\n", target, err)
+		} else {
+			logger = newSyslogLogger(sys, getHostname(), *(appFlags[tagIndex].value.(*string)))
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid --log-target %q (expected %s, %s, %s or %s)\n", target, logTargetFile, logTargetStdout, logTargetSyslog, logTargetEventLog)
+		os.Exit(exitUsage)
+	}
+	if logger == nil {
+		// Set up the log file location and log to it.
+		logFile = filepath.Join(getLogFileDirectory(), appName+".log")
+		file, err := openLogFile(logFile, int64(getFlagInt(logMaxSizeIndex))*1024*1024)
+		if err != nil {
+			log.Fatalf("Error opening log file: %v", err)
+		}
+		logger = newAppLogger(file, getHostname(), *(appFlags[tagIndex].value.(*string)))
+	}
+	if err := logger.setFormat(*(appFlags[logFormatIndex].value.(*string))); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	if configErr != nil {
+		logger.Errorf("Ignoring config file %s: %v\n", getConfigFilePath(), configErr)
+		fmt.Fprintf(os.Stderr, "Warning: ignoring config file %s: %v\n", getConfigFilePath(), configErr)
+	}
+
+	exitOnError(applyCategoryPolicy())
+
+	if cd := *(appFlags[confirmDefaultIndex].value.(*string)); cd != "proceed" && cd != "abort" {
+		fmt.Fprintf(os.Stderr, "Error: invalid --confirm-default %q (expected proceed or abort)\n", cd)
+		os.Exit(exitUsage)
+	}
+	if when := *(appFlags[confirmWhenIndex].value.(*string)); when != confirmAtEnd && when != confirmAtStart {
+		fmt.Fprintf(os.Stderr, "Error: invalid --confirm-when %q (expected start or end)\n", when)
+		os.Exit(exitUsage)
+	}
+	if output := *(appFlags[outputIndex].value.(*string)); output != outputText && output != outputJSON {
+		fmt.Fprintf(os.Stderr, "Error: invalid --output %q (expected %s or %s)\n", output, outputText, outputJSON)
+		os.Exit(exitUsage)
+	}
+	exitOnError(loadMessageFile())
+	exitOnError(checkMessageTemplate())
+
+	// List pending actions of other sysreboot processes and exit.
+	if *(appFlags[listIndex].value.(*bool)) {
+		if err := listScheduled(); err != nil {
+			logger.Errorf("Error listing actions: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitFailure)
+		}
+		os.Exit(exitSuccess)
+	}
+
+	// Show the last action performed by sysreboot and exit.
+	if *(appFlags[lastIndex].value.(*bool)) {
+		if err := printLastAction(); err != nil {
+			logger.Errorf("Error reading last action: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitFailure)
+		}
+		os.Exit(exitSuccess)
+	}
+
+	// Cancel a pending action started by another sysreboot process and exit.
+	// Like shutdown(8), --time cancel does the same.
+	if *(appFlags[cancelIndex].value.(*bool)) || *(appFlags[timeIndex].value.(*string)) == "cancel" {
+		if err := cancelPendingAction(); err != nil {
+			logger.Errorf("Error cancelling action: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitFailure)
+		}
+		os.Exit(exitSuccess)
+	}
+
+	// --time now, also borrowed from shutdown(8), performs the action right away.
+	if *(appFlags[timeIndex].value.(*string)) == "now" {
+		*(appFlags[timeIndex].value.(*string)) = ""
+	}
+	if *(appFlags[nowIndex].value.(*bool)) {
+		exitOnError(applyNow())
+	}
+
+	// Report a reboot that completed since the last run and exit.
+	if *(appFlags[reportBootIndex].value.(*bool)) {
+		exitOnError(reportBoot())
+		os.Exit(exitSuccess)
+	}
+
+	// Run one action per directive read from stdin and exit.
+	if *(appFlags[stdinIndex].value.(*bool)) {
+		exitOnError(runDirectives(os.Stdin))
+		os.Exit(exitSuccess)
+	}
+
+	// Determine the action to take based on flags provided by the user,
+	// refusing ambiguous combinations such as --halt --poweroff.
+	action, err := resolveAction()
+	exitOnError(err)
+	logger.setAction(action)
+	if *(appFlags[verboseIndex].value.(*bool)) {
+		logEffectiveConfig(action)
+	}
+	exitOnError(checkActionSupported(action))
+	if *(appFlags[kexecIndex].value.(*bool)) && action != "reboot" {
+		exitOnError(usageError{fmt.Errorf("--kexec only applies to reboot, not %s", action)})
+	}
+
+	// Report whether the action could proceed and exit without doing anything.
+	if *(appFlags[checkIndex].value.(*bool)) {
+		ok, results := runPreflight(action)
+		for _, result := range results {
+			logger.Info("Preflight: " + result.String())
+			fmt.Println(result)
+		}
+		if !ok {
+			os.Exit(exitFailure)
+		}
+		os.Exit(exitSuccess)
+	}
+
+	// Describe the plan in prose and exit without doing anything.
+	if *(appFlags[explainIndex].value.(*bool)) {
+		for _, line := range explainPlan(action) {
+			fmt.Println(line)
+		}
+		os.Exit(exitSuccess)
+	}
+
+	// Use the notification machinery on its own, ignoring everything else.
+	if *(appFlags[notifyOnlyIndex].value.(*bool)) {
+		exitOnError(sendNotificationsOnly(action))
+		os.Exit(exitSuccess)
+	}
+
+	// A dry run reports the preflight checks up front; with --output json it
+	// prints the whole plan as one object instead, and stops there.
+	if *(appFlags[dryRunIndex].value.(*bool)) {
+		ok, results := runPreflight(action)
+		if jsonOutput() {
+			exitOnError(printDryRunPlan(action, ok, results))
+			if !ok {
+				os.Exit(exitFailure)
+			}
+			os.Exit(exitSuccess)
+		}
+		for _, result := range results {
+			logger.Info("Preflight: " + result.String())
+			printLine("Dry run: preflight " + result.String())
+		}
+	}
+
+	// --force overrides every guard below; make sure that never goes unnoticed.
+	force := *(appFlags[forceIndex].value.(*bool))
+	if force {
+		logger.Infof("WARNING: --force given, skipping confirmation and safety checks for %s.\n", action)
+		fmt.Fprintf(os.Stderr, "Warning: --force given, skipping confirmation and safety checks for %s.\n", action)
+	}
+
+	// Skip the action entirely if it was only wanted when a reboot is pending.
+	if !force && *(appFlags[ifRequiredIndex].value.(*bool)) && !rebootRequired() {
+		printLine("No reboot required.")
+		logger.Info("No reboot required, skipping " + action + ".")
+		reportSkipped(action, "no reboot required")
+		os.Exit(exitSuccess)
+	}
+
+	// Skip the action if someone is still using the machine.
+	if !force && *(appFlags[ifIdleIndex].value.(*bool)) {
+		sessions, err := activeSessions()
+		exitOnError(err)
+		if len(sessions) > 0 {
+			printf("Skipping %s: active sessions: %s.\n", action, strings.Join(sessions, ", "))
+			logger.Infof("Skipping %s: active sessions: %s.\n", action, strings.Join(sessions, ", "))
+			reportSkipped(action, "active sessions: "+strings.Join(sessions, ", "))
+			os.Exit(exitSuccess)
+		}
+	}
+
+	// Skip the action on machines that were booted recently.
+	if minUptime := *(appFlags[maxUptimeIndex].value.(*string)); !force && minUptime != "" {
+		threshold, err := parseDurationWithDays(minUptime)
+		if err != nil {
+			exitOnError(usageError{fmt.Errorf("invalid --max-uptime: %v", err)})
+		}
+		up, err := uptime()
+		exitOnError(err)
+		if up < threshold {
+			printf("Skipping %s: uptime %s is below %s.\n", action, up.Round(time.Second), minUptime)
+			logger.Infof("Skipping %s: uptime %s is below %s.\n", action, up.Round(time.Second), minUptime)
+			reportSkipped(action, fmt.Sprintf("uptime %s is below %s", up.Round(time.Second), minUptime))
+			os.Exit(exitSuccess)
+		}
+	}
+
+	// Skip the action while the machine looks busy with important work. Guards
+	// that cannot be evaluated on this system are ignored.
+	if maxLoad := *(appFlags[maxLoadIndex].value.(*string)); maxLoad != "" {
+		if limit, err := strconv.ParseFloat(maxLoad, 64); err != nil || limit < 0 {
+			exitOnError(usageError{fmt.Errorf("invalid --max-load %q: expected a non-negative number", maxLoad)})
+		}
+	}
+	guards := []struct {
+		name  string
+		given bool
+		check func() (bool, string, error)
+	}{
+		{"max-load", *(appFlags[maxLoadIndex].value.(*string)) != "", checkMaxLoad},
+		{"min-free-mem", getFlagInt(minFreeMemIndex) > 0, checkMinFreeMem},
+	}
+	for _, guard := range guards {
+		if force || !guard.given {
+			continue
+		}
+		ok, detail, err := guard.check()
+		if err != nil {
+			logger.Infof("Ignoring --%s: %v\n", guard.name, err)
+			printf("Warning: ignoring --%s: %v.\n", guard.name, err)
+			continue
+		}
+		if !ok {
+			printf("Skipping %s: %s.\n", action, detail)
+			logger.Infof("Skipping %s: %s.\n", action, detail)
+			reportSkipped(action, detail)
+			os.Exit(exitSuccess)
+		}
+	}
+
+	// Verify the action can be performed before waiting for it.
+	if !force {
+		exitOnError(checkContainer(action, *(appFlags[dryRunIndex].value.(*bool))))
+	}
+	checkPrivileges(action, *(appFlags[dryRunIndex].value.(*bool)))
+	if bin := *(appFlags[shutdownBinIndex].value.(*string)); bin != "" {
+		if _, err := exec.LookPath(bin); err != nil {
+			exitOnError(usageError{fmt.Errorf("invalid --shutdown-bin: %v", err)})
+		}
+	}
+	if !*(appFlags[dryRunIndex].value.(*bool)) {
+		exitOnError(checkSystemCommand(action))
+	}
+
+	if wakeAt := *(appFlags[wakeAtIndex].value.(*string)); wakeAt != "" {
+		if _, err := parseScheduleTime(wakeAt, scheduleNow()); err != nil {
+			exitOnError(usageError{fmt.Errorf("invalid --wake-at: %v", err)})
+		}
+	}
+
+	if name := *(appFlags[timezoneIndex].value.(*string)); name != "" {
+		if _, err := time.LoadLocation(name); err != nil {
+			exitOnError(usageError{fmt.Errorf("invalid --timezone %q: %v", name, err)})
+		}
+	}
+
+	// Make sure a date names a moment in the future before anything is scheduled.
+	dateStr := *(appFlags[dateIndex].value.(*string))
+	if dateStr != "" {
+		if _, err := reboot.ParseTime(dateStr, *(appFlags[timeIndex].value.(*string)), scheduleNow()); err != nil {
+			exitOnError(usageError{err})
+		}
+	}
+
+	// Resolve the delay. --delay is kept in minutes for backward compatibility;
+	// --wait accepts any duration.
+	timeStr := *(appFlags[timeIndex].value.(*string))
+	delay := time.Duration(*(appFlags[delayIndex].value.(*int))) * time.Minute
+	if wait := *(appFlags[waitIndex].value.(*string)); wait != "" {
+		if delay != 0 {
+			fmt.Fprintf(os.Stderr, "Error: --delay and --wait cannot be used together\n")
+			os.Exit(exitUsage)
+		}
+		parsed, err := parseDelay(wait)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		delay = parsed
+	}
+	if warnAt := *(appFlags[warnAtIndex].value.(*string)); warnAt != "" {
+		if _, err := parseWarnAt(warnAt); err != nil {
+			exitOnError(usageError{err})
+		}
+	}
+	if jitter := *(appFlags[jitterIndex].value.(*string)); jitter != "" {
+		if _, err := parseDelay(jitter); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --jitter: %v\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+
+	// Hand a recurring action over to the OS scheduler, which runs sysreboot again
+	// on every occurrence.
+	if repeat := *(appFlags[repeatIndex].value.(*string)); repeat != "" {
+		schedule, err := parseRecurringSchedule(repeat, dateStr, timeStr, scheduleNow())
+		if err != nil {
+			exitOnError(usageError{err})
+		}
+		exitOnError(installRecurringSchedule(action, schedule, *(appFlags[dryRunIndex].value.(*bool))))
+		return
+	}
+
+	// Delegate the wait to systemd when requested, falling back to waiting here.
+	if *(appFlags[useSystemdShutdownIndex].value.(*bool)) && (timeStr != "" || delay > 0) {
+		switch option := systemdInProcessOption(action); {
+		case option != "":
+			logger.Infof("%s needs sysreboot at the time of the action, waiting in-process instead.\n", option)
+			printf("%s needs sysreboot at the time of the action, waiting in-process instead.\n", option)
+		case systemdAvailable():
+			exitOnError(handleSystemdShutdown(dateStr, timeStr, delay, action))
+			return
+		default:
+			logger.Info("systemd not detected, waiting in-process instead.")
+			printLine("systemd not detected, waiting in-process instead.")
+		}
+	}
+
+	// Hand the wait to the at daemon when requested, falling back to waiting here.
+	if *(appFlags[useAtIndex].value.(*bool)) && (timeStr != "" || delay > 0) {
+		if atAvailable() {
+			exitOnError(handleAtSchedule(dateStr, timeStr, delay, action))
+			return
+		}
+		logger.Info("at not available, waiting in-process instead.")
+		printLine("at not available, waiting in-process instead.")
+	}
+
+	// Allow only one pending action at a time, so that overlapping runs such as
+	// a cron job and a manual invocation cannot both act. Dry runs never act.
+	if !*(appFlags[dryRunIndex].value.(*bool)) {
+		exitOnError(acquireActionLock())
+	}
+
+	// Leave the wait to a detached copy of this process that outlives the
+	// terminal; the copy runs everything below and takes the lock over.
+	if *(appFlags[daemonIndex].value.(*bool)) && !runningAsDaemon() {
+		if confirmationRequired() {
+			exitOnError(usageError{errors.New("--daemon cannot be used with --confirm or --confirm-phrase")})
+		}
+		if getFlagInt(cancelWindowIndex) > 0 {
+			exitOnError(usageError{errors.New("--daemon cannot be used with --cancel-window")})
+		}
+		releaseActionLock()
+		exitOnError(startDaemon(action))
+		return
+	}
+
+	// Handle scheduled time if provided, otherwise proceed with a delayed or
+	// immediate action. SIGINT and SIGTERM cancel the action until it has run.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if runningAsDaemon() {
+		// Without a terminal, SIGHUP is free to mean "re-read the config file".
+		signal.Notify(reloadSignals, syscall.SIGHUP)
+	}
+	endPreflight()
+	if timeStr != "" {
+		err = handleScheduledTime(ctx, dateStr, timeStr, action)
+	} else {
+		err = handleDelay(ctx, delay, action)
+	}
+	reportResult(action, err)
+	exitOnError(err)
+}
+
+// handleSystemdShutdown schedules an action through systemd's shutdown command.
+func handleSystemdShutdown(dateStr string, timeStr string, delay time.Duration, action string) error {
+	// None of our checks run when shutdown(8) acts, so heed the inhibitors
+	// before handing the action over.
+	if err := checkInhibitors(action); err != nil {
+		return err
+	}
+	message := composeMessage()
+	confirmation := confirmationRequired()
+	dryRun := *(appFlags[dryRunIndex].value.(*bool))
+
+	// shutdown(8) only accepts a local time of day, so hand a dated schedule over
+	// as an offset. The same goes for a time that is moved by --jitter or given
+	// in another zone.
+	offset := jitterOffset(action)
+	if dateStr != "" || (timeStr != "" && (offset > 0 || *(appFlags[timezoneIndex].value.(*string)) != "")) {
+		target, err := reboot.ParseTime(dateStr, timeStr, scheduleNow())
+		if err != nil {
+			return usageError{err}
+		}
+		timeStr, delay = "", target.Sub(clock.Now())
+	}
+	delay += offset
+
+	at := clock.Now().Add(delay)
+	if timeStr != "" {
+		if target, err := reboot.ParseTime("", timeStr, scheduleNow()); err == nil {
+			at = target
+		}
+	}
+	// As in the in-process wait, a poweroff or halt waits at least --min-delay;
+	// a time of day that comes too soon is handed over as an offset instead.
+	until := at.Sub(clock.Now())
+	if wait := enforceMinDelay(action, until); wait != until {
+		timeStr, delay, at = "", wait, clock.Now().Add(wait)
+	}
+
+	// shutdown(8) broadcasts the message itself, so fill in its template now
+	// and clean it up as wall would.
+	setMessageSchedule(action, at)
+	if message != "" {
+		message = reboot.SanitizeMessage(formatWarning(message, humanizeDuration(at.Sub(clock.Now()))))
+	}
+
+	return scheduleWithSystemdShutdown(action, timeStr, delay, message, confirmation, dryRun)
+}
+
+func enforceMinDelay(action string, delay time.Duration) time.Duration {
+	// Give users at least --min-delay before the machine goes down for good;
+	// reboot and sleep actions bring it back and are not affected.
+	minDelay := time.Duration(getFlagInt(minDelayIndex)) * time.Second
+	if (action != "poweroff" && action != "halt") || delay >= minDelay {
+		return delay
+	}
+	logger.Infof("Delay of %s is below --min-delay for %s, waiting %s instead.\n", delay, action, minDelay)
+	printf("Delay of %s is below --min-delay for %s, waiting %s instead.\n", delay, action, minDelay)
+	return minDelay
+}
+
+// jitterRand picks the --jitter offsets; it is seeded per process so that
+// machines started at the same moment still spread out.
+var jitterRand = rand.New(rand.NewSource(clock.Now().UnixNano() ^ int64(os.Getpid())))
+
+func jitterOffset(action string) time.Duration {
+	// Pick a random whole number of seconds between 0 and --jitter to add to
+	// the wait, logging the choice so that the actual schedule can be traced.
+	jitter, _ := parseDelay(*(appFlags[jitterIndex].value.(*string)))
+	if jitter <= 0 {
+		return 0
+	}
+	offset := time.Duration(jitterRand.Int63n(int64(jitter/time.Second)+1)) * time.Second
+	logger.Infof("Adding a jitter of %s (of up to %s) to the %s.\n", offset, jitter, action)
+	return offset
+}
+
+func parseDelay(s string) (time.Duration, error) {
+	// Parse a delay given as a duration ("30s", "3h", "1h30m") or as a bare
+	// number of minutes.
+	if minutes, err := strconv.Atoi(s); err == nil {
+		s = strconv.Itoa(minutes) + "m"
+	}
+	delay, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid delay: %v", err)
+	}
+	if delay < 0 {
+		return 0, fmt.Errorf("invalid delay: %q is negative", s)
+	}
+	return delay, nil
+}
+
+// handleScheduledTime schedules an action at a specific time.
+func handleScheduledTime(ctx context.Context, dateStr, timeStr, action string) error {
+	message := composeMessage()
+	confirmation := confirmationRequired()
+	dryRun := *(appFlags[dryRunIndex].value.(*bool))
+
+	return scheduleAtSpecificTime(ctx, dateStr, timeStr, action, message, confirmation, dryRun)
+}
+
+// handleDelay sets a delay before executing an action.
+func handleDelay(ctx context.Context, delay time.Duration, action string) error {
+	message := composeMessage()
+	confirmation := confirmationRequired()
+	dryRun := *(appFlags[dryRunIndex].value.(*bool))
+
+	// Log and wait if a delay is set, then execute the action.
+	delay = enforceMinDelay(action, delay+jitterOffset(action))
+	checkpoints, err := planWarnings(delay, composeMessages())
+	if err != nil {
+		return usageError{err}
+	}
+	confirmation, err = confirmBeforeWait(ctx, confirmation)
+	if err != nil {
+		return err
+	}
+
+	// The delay starts once the confirmation, if any, has been answered.
+	at := clock.Now().Add(delay)
+	setMessageSchedule(action, at)
+	armWarnings(at, delay, checkpoints, composeMessages())
+	if delay > 0 {
+		logger.Infof("%s scheduled in %s.\n", action, humanizeDuration(delay))
+		printf("%s scheduled in %s.\n", action, humanizeDuration(delay))
+		logAudit(action, "scheduled for "+at.Format(time.RFC3339))
+		reportScheduled(action, at)
+		waitForAction(ctx, action, phaseScheduled, at)
+		message = composeMessage() // A config reload during the wait may have changed it.
+	}
+	gracePeriod(ctx, action, message, dryRun)
+
+	return executeAction(ctx, action, message, confirmation, dryRun)
+}
+
+// finalCountdown is how long the final warning of a --grace period precedes the action.
+const finalCountdown = 10 * time.Second
+
+func gracePeriod(ctx context.Context, action string, message string, dryRun bool) {
+	// With --grace, warn users and give applications time to save their work,
+	// then send a final warning and count down briefly before the action runs.
+	grace := time.Duration(getFlagInt(graceIndex)) * time.Second
+	if grace <= 0 {
+		return
+	}
+	if message == "" {
+		message = "The system will " + action + " in %s. Please save your work."
+	}
+
+	logger.Infof("Grace period: waiting %s before the final countdown to the %s.\n", grace, action)
+	printf("Grace period: waiting %s before the final countdown to the %s.\n", grace, action)
+	broadcastMessage(formatWarning(message, (grace+finalCountdown).String()), dryRun)
+	waitForAction(ctx, action, phaseGrace, clock.Now().Add(grace))
 
-	executeAction(action, message, confirmation)
+	logger.Infof("Grace period over: final countdown of %s to the %s.\n", finalCountdown, action)
+	printf("Grace period over: final countdown of %s to the %s.\n", finalCountdown, action)
+	broadcastMessage(formatWarning(message, finalCountdown.String()), dryRun)
+	waitForAction(ctx, action, phaseFinalCountdown, clock.Now().Add(finalCountdown))
 }
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"sysreboot/reboot"
+)
+
+func TestMain(m *testing.M) {
+	logger = newAppLogger(io.Discard, "test", "")
+	*(appFlags[quietIndex].value.(*bool)) = true
+	os.Exit(m.Run())
+}
+
+func setFlag(t *testing.T, index int, raw string) {
+	// Give a flag a value for the rest of the test, as if read from the config
+	// file, and put the old value back afterwards.
+	t.Helper()
+	fd := appFlags[index]
+	saved := map[int]interface{}{index: copyFlagValue(fd)}
+	t.Cleanup(func() { restoreFlags(saved) })
+	value, err := parseFlagValue(fd, raw)
+	if err != nil {
+		t.Fatalf("invalid value %q for --%s: %v", raw, fd.longName, err)
+	}
+	assignFlagValue(fd, value)
+}
+
+func parseCommandLine(t *testing.T, args ...string) {
+	// Parse args into the flags as a fresh invocation of sysreboot would, and
+	// put the command line and every flag value back afterwards.
+	t.Helper()
+	saved := make(map[int]interface{}, len(appFlags))
+	for index, fd := range appFlags {
+		saved[index] = copyFlagValue(fd)
+		if list, ok := fd.value.(*stringList); ok {
+			*list = nil
+		}
+	}
+	commandLine := flag.CommandLine
+	t.Cleanup(func() {
+		flag.CommandLine = commandLine
+		restoreFlags(saved)
+	})
+	flag.CommandLine = flag.NewFlagSet(appName, flag.ContinueOnError)
+	flag.CommandLine.SetOutput(io.Discard)
+	defineFlags(flag.CommandLine)
+	*(appFlags[quietIndex].value.(*bool)) = true // As set up by TestMain.
+	if err := flag.CommandLine.Parse(args); err != nil {
+		t.Fatalf("parsing %q: %v", args, err)
+	}
+}
+
+// recordingRunner records the commands it is given instead of starting them,
+// failing the first len(errs) of them with those errors.
+type recordingRunner struct {
+	commands [][]string
+	errs     []error
+}
+
+func (r *recordingRunner) Run(cmd *exec.Cmd) error {
+	r.commands = append(r.commands, cmd.Args)
+	if len(r.errs) > 0 {
+		err := r.errs[0]
+		r.errs = r.errs[1:]
+		return err
+	}
+	return nil
+}
+
+func useRunner(t *testing.T, runner reboot.Runner) {
+	// Run the system commands of the test through runner.
+	t.Helper()
+	saved := systemCommandRunner
+	systemCommandRunner = runner
+	t.Cleanup(func() { systemCommandRunner = saved })
+}
+
+func TestExecuteSystemCommandRunsDefaultCommand(t *testing.T) {
+	want, err := reboot.DefaultCommand("poweroff")
+	if err != nil || want == nil {
+		t.Skipf("no poweroff command on this OS: %v", err)
+	}
+	runner := &recordingRunner{}
+	useRunner(t, runner)
+
+	if err := executeSystemCommand(context.Background(), "poweroff", false); err != nil {
+		t.Fatalf("executeSystemCommand: %v", err)
+	}
+	if !reflect.DeepEqual(runner.commands, [][]string{want}) {
+		t.Errorf("ran %q, want %q", runner.commands, [][]string{want})
+	}
+}
+
+func TestExecuteSystemCommandDryRunRunsNothing(t *testing.T) {
+	runner := &recordingRunner{}
+	useRunner(t, runner)
+
+	if err := executeSystemCommand(context.Background(), "reboot", true); err != nil {
+		t.Fatalf("executeSystemCommand: %v", err)
+	}
+	if len(runner.commands) != 0 {
+		t.Errorf("dry run ran %q, want nothing", runner.commands)
+	}
+}
+
+func TestExecuteSystemCommandReplacesBinary(t *testing.T) {
+	want, err := reboot.DefaultCommand("reboot")
+	if err != nil || want == nil {
+		t.Skipf("no reboot command on this OS: %v", err)
+	}
+	want = append([]string(nil), want...)
+	if want[0] == "sudo" {
+		want[1] = "/opt/bin/shutdown"
+	} else {
+		want[0] = "/opt/bin/shutdown"
+	}
+	setFlag(t, shutdownBinIndex, "/opt/bin/shutdown")
+	runner := &recordingRunner{}
+	useRunner(t, runner)
+
+	if err := executeSystemCommand(context.Background(), "reboot", false); err != nil {
+		t.Fatalf("executeSystemCommand: %v", err)
+	}
+	if !reflect.DeepEqual(runner.commands, [][]string{want}) {
+		t.Errorf("ran %q, want %q", runner.commands, [][]string{want})
+	}
+}
+
+func TestExecuteSystemCommandReportsFailure(t *testing.T) {
+	failure := errors.New("exit status 1")
+	runner := &recordingRunner{errs: []error{failure}}
+	useRunner(t, runner)
+
+	err := executeSystemCommand(context.Background(), "reboot", false)
+	var ae *reboot.ActionError
+	if !errors.As(err, &ae) || ae.Stage != reboot.StageExecute || !errors.Is(err, failure) {
+		t.Fatalf("executeSystemCommand error = %v, want an execute ActionError wrapping %v", err, failure)
+	}
+	if len(runner.commands) != 1 {
+		t.Errorf("ran %d commands without --retry, want 1", len(runner.commands))
+	}
+}
+
+func TestReadConfirmation(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"", false},
+		{"\n", false},
+		{"yes\n", true},
+		{"Y\n", true},
+		{"  yes  \n", true},
+		{"yes", true},
+		{"no\n", false},
+		{"yesterday\n", false},
+	}
+	for _, tt := range tests {
+		if got := readConfirmation(strings.NewReader(tt.input), confirmOptions{}); got != tt.want {
+			t.Errorf("readConfirmation(%q) = %t, want %t", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestReadConfirmationClosedReader(t *testing.T) {
+	r, w := io.Pipe()
+	w.Close()
+	r.Close()
+	if readConfirmation(r, confirmOptions{}) {
+		t.Error("readConfirmation on a closed reader = true, want false")
+	}
+}
+
+func TestReadConfirmationPhrase(t *testing.T) {
+	opts := confirmOptions{phrase: "REBOOT db1"}
+	if !readConfirmation(strings.NewReader("REBOOT db1\n"), opts) {
+		t.Error("the exact phrase was not accepted")
+	}
+	if readConfirmation(strings.NewReader("yes\n"), opts) {
+		t.Error("yes was accepted in place of the phrase")
+	}
+}
+
+func TestHumanizeDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0s"},
+		{499 * time.Millisecond, "0s"},
+		{1500 * time.Millisecond, "2s"},
+		{4*time.Minute + 29*time.Second + 600*time.Millisecond, "4m30s"},
+		{59*time.Minute + 59*time.Second + 400*time.Millisecond, "59m59s"},
+		{time.Hour, "1h0m0s"},
+		{time.Hour + 29*time.Second, "1h0m0s"},
+		{26*time.Hour + 14*time.Minute + 30*time.Second, "26h15m0s"},
+	}
+	for _, tt := range tests {
+		if got := humanizeDuration(tt.d); got != tt.want {
+			t.Errorf("humanizeDuration(%s) = %s, want %s", tt.d, got, tt.want)
+		}
+	}
+}
+
+func useUID(t *testing.T, uid int) {
+	// Pretend to run with the given effective user ID for the rest of the test.
+	t.Helper()
+	saved := effectiveUID
+	effectiveUID = func() int { return uid }
+	t.Cleanup(func() { effectiveUID = saved })
+}
+
+func TestHasSufficientPrivileges(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows checks the process token, not the user ID")
+	}
+	useUID(t, 0)
+	if ok, err := hasSufficientPrivileges(); !ok || err != nil {
+		t.Errorf("hasSufficientPrivileges as root = %t, %v; want true", ok, err)
+	}
+
+	if runtime.GOOS != "linux" {
+		t.Skip("other users depend on sudo on this OS")
+	}
+	useUID(t, 1000)
+	if ok, err := hasSufficientPrivileges(); ok || err != nil {
+		t.Errorf("hasSufficientPrivileges as uid 1000 = %t, %v; want false", ok, err)
+	}
+}
+
+func useAbortFile(t *testing.T) string {
+	// Point --abort-file at a file in a scratch directory that does not exist yet.
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "abort")
+	setFlag(t, abortFileIndex, path)
+	return path
+}
+
+func TestWaitWithCountdownTicksUntilDeadline(t *testing.T) {
+	c := newFakeClock(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	useAbortFile(t)
+	deadline := c.Now().Add(2500 * time.Millisecond)
+
+	completed, cause := waitWithCountdown(context.Background(), "reboot", phaseScheduled, deadline)
+	if !completed || cause != "" {
+		t.Fatalf("waitWithCountdown = %t, %q; want true", completed, cause)
+	}
+	if want := []time.Duration{time.Second, time.Second, 500 * time.Millisecond}; !reflect.DeepEqual(c.waits, want) {
+		t.Errorf("waited %v, want %v", c.waits, want)
+	}
+	if !c.Now().Equal(deadline) {
+		t.Errorf("returned at %s, want %s", c.Now(), deadline)
+	}
+}
+
+func TestWaitWithCountdownPastDeadline(t *testing.T) {
+	c := newFakeClock(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	useAbortFile(t)
+
+	if completed, _ := waitWithCountdown(context.Background(), "reboot", phaseScheduled, c.Now().Add(-time.Minute)); !completed {
+		t.Fatal("waitWithCountdown with a past deadline did not complete")
+	}
+	if len(c.waits) != 0 {
+		t.Errorf("waited %v for a past deadline, want no wait", c.waits)
+	}
+}
+
+func TestWaitWithCountdownFollowsWallClockJumps(t *testing.T) {
+	// A resume from suspend moves the wall clock past the deadline at once.
+	c := newFakeClock(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	useAbortFile(t)
+	c.onAfter = func() {
+		c.onAfter = nil
+		c.Advance(2 * time.Hour)
+	}
+
+	if completed, _ := waitWithCountdown(context.Background(), "reboot", phaseScheduled, c.Now().Add(time.Hour)); !completed {
+		t.Fatal("waitWithCountdown did not complete")
+	}
+	if len(c.waits) != 1 {
+		t.Errorf("waited %v after the clock jumped past the deadline, want a single tick", c.waits)
+	}
+}
+
+func TestWaitWithCountdownStopsForAbortFile(t *testing.T) {
+	c := newFakeClock(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	path := useAbortFile(t)
+	c.onAfter = func() {
+		if len(c.waits) == 3 {
+			if err := os.WriteFile(path, nil, 0644); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	completed, cause := waitWithCountdown(context.Background(), "reboot", phaseScheduled, c.Now().Add(time.Hour))
+	if completed || cause != "abort file "+path {
+		t.Fatalf("waitWithCountdown = %t, %q; want false for the abort file", completed, cause)
+	}
+	if len(c.waits) != 3 {
+		t.Errorf("stopped after %d ticks, want 3", len(c.waits))
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("the abort file was not removed")
+	}
+}
+
+func TestWaitWithCountdownStopsWhenCancelled(t *testing.T) {
+	c := newFakeClock(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	useAbortFile(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	completed, cause := waitWithCountdown(ctx, "reboot", phaseScheduled, c.Now().Add(time.Hour))
+	if completed || cause != "signal" {
+		t.Fatalf("waitWithCountdown = %t, %q; want false for the signal", completed, cause)
+	}
+}
+
+func TestFormatWarningDecoratesRenderedMessage(t *testing.T) {
+	// A reason that looks like a template or a placeholder is passed on as is.
+	setFlag(t, reasonIndex, "{{.Host}} at 100%s")
+	setFlag(t, tagMessageIndex, "false")
+	setMessageSchedule("reboot", time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC))
+
+	got := formatWarning("Rebooting {{.Action}} in %s", "5m0s")
+	if want := "Rebooting reboot in 5m0s (Reason: {{.Host}} at 100%s)"; got != want {
+		t.Errorf("formatWarning = %q, want %q", got, want)
+	}
+}
+
+func TestPlanWarningsAllowsOneMessageWithoutCheckpoints(t *testing.T) {
+	for _, total := range []time.Duration{0, 5 * time.Second} {
+		checkpoints, err := planWarnings(total, []string{"Rebooting now"})
+		if err != nil {
+			t.Errorf("planWarnings(%s, one message): %v", total, err)
+		}
+		if len(checkpoints) != 0 {
+			t.Errorf("planWarnings(%s) = %v, want no checkpoints", total, checkpoints)
+		}
+	}
+}
+
+func TestPlanWarningsPairsMessagesWithinWait(t *testing.T) {
+	setFlag(t, warnAtIndex, "10m,5m,1m")
+	checkpoints, err := planWarnings(7*time.Minute, []string{"first", "second"})
+	if err != nil {
+		t.Fatalf("planWarnings: %v", err)
+	}
+	if want := []time.Duration{5 * time.Minute, time.Minute}; !reflect.DeepEqual(checkpoints, want) {
+		t.Errorf("planWarnings = %v, want %v", checkpoints, want)
+	}
+	if _, err := planWarnings(7*time.Minute, []string{"a", "b", "c"}); err == nil {
+		t.Error("planWarnings accepted three messages for two checkpoints")
+	}
+	if _, err := planWarnings(0, []string{"a", "b", "c"}); err != nil {
+		t.Errorf("planWarnings without a wait: %v", err)
+	}
+}
+
+func TestForwardedJobsAcceptWarnAt(t *testing.T) {
+	// The jobs handed to at or the recurring schedule run without a wait, so
+	// a --warn-at that fits the original wait must not fail them.
+	for _, skipFlags := range [][]int{atSkipFlags, repeatSkipFlags} {
+		parseCommandLine(t, "--reboot", "--delay=60", "--warn-at=30m,1m", "--message=Rebooting in %s", "--use-at")
+		if _, err := planWarnings(60*time.Minute, composeMessages()); err != nil {
+			t.Fatalf("planWarnings for the original wait: %v", err)
+		}
+		args := forwardedFlags(skipFlags)
+		parseCommandLine(t, append([]string{"--action=reboot"}, args...)...)
+		if _, err := planWarnings(0, composeMessages()); err != nil {
+			t.Errorf("planWarnings for the job %q: %v", args, err)
+		}
+	}
+}
+
+func TestPlanWarningsSkipsWarnAtCheckWithoutWait(t *testing.T) {
+	parseCommandLine(t, "--warn-at=30m")
+	if _, err := planWarnings(0, nil); err != nil {
+		t.Errorf("planWarnings(0) with --warn-at: %v", err)
+	}
+	if _, err := planWarnings(10*time.Minute, nil); err == nil {
+		t.Error("planWarnings accepted a --warn-at checkpoint beyond the wait")
+	}
+}
+
+func TestHandleAtScheduleAppliesMinDelay(t *testing.T) {
+	// A poweroff submitted to at is due no sooner than --min-delay, and the
+	// job does not wait for it a second time.
+	newFakeClock(t, time.Date(2026, 10, 14, 10, 0, 0, 0, time.Local))
+	var log bytes.Buffer
+	saved := logger
+	logger = newAppLogger(&log, "test", "")
+	t.Cleanup(func() { logger = saved })
+	parseCommandLine(t, "--poweroff", "--delay=1", "--min-delay=300", "--grace=30", "--use-at", "--dry-run")
+
+	if err := handleAtSchedule("", "", time.Minute, "poweroff"); err != nil {
+		t.Fatalf("handleAtSchedule: %v", err)
+	}
+	if !strings.Contains(log.String(), "at -t 202610141005:") {
+		t.Errorf("job not submitted for 10:05:\n%s", log.String())
+	}
+	if strings.Contains(log.String(), "--min-delay=") {
+		t.Errorf("--min-delay passed on to the job:\n%s", log.String())
+	}
+	if !strings.Contains(log.String(), "--grace=30") {
+		t.Errorf("--grace not passed on to the job:\n%s", log.String())
+	}
+}
+
+func TestSystemdInProcessOption(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"--message=Rebooting in %s", "--notify=false"}, ""},
+		{[]string{"--wall=false"}, "--wall"},
+		{[]string{"--grace=30"}, "--grace"},
+		{[]string{"--warn-at=10m"}, "--warn-at"},
+		{[]string{"--command-timeout=60"}, "--command-timeout"},
+		{[]string{"--kexec"}, "--kexec"},
+		{[]string{"--notify-user=alice"}, "--notify-user"},
+		{[]string{"--notify"}, "--notify"},
+		{[]string{"--message=first", "--message=second"}, "Repeating --message"},
+	} {
+		parseCommandLine(t, tc.args...)
+		if got := systemdInProcessOption("reboot"); got != tc.want {
+			t.Errorf("systemdInProcessOption with %q = %q, want %q", tc.args, got, tc.want)
+		}
+	}
+
+	parseCommandLine(t)
+	t.Cleanup(func() { delete(commandOverrides, "reboot") })
+	commandOverrides["reboot"] = []string{"kill", "-TERM", "1"}
+	if got, want := systemdInProcessOption("reboot"), "The reboot_command setting"; got != want {
+		t.Errorf("systemdInProcessOption with a command override = %q, want %q", got, want)
+	}
+	if got := systemdInProcessOption("poweroff"); got != "" {
+		t.Errorf("systemdInProcessOption for another action = %q, want none", got)
+	}
+}
+
+func TestConfirmBeforeWaitDefaultsToStart(t *testing.T) {
+	// By default the confirmation is asked before the wait and not again.
+	parseCommandLine(t)
+	t.Setenv(confirmEnvVar, "no")
+	if _, err := confirmBeforeWait(context.Background(), true); err != errCancelled {
+		t.Errorf("confirmBeforeWait = %v, want %v", err, errCancelled)
+	}
+	t.Setenv(confirmEnvVar, confirmText.responses[0])
+	if again, err := confirmBeforeWait(context.Background(), true); err != nil || again {
+		t.Errorf("confirmBeforeWait = %t, %v; want no second confirmation", again, err)
+	}
+
+	setFlag(t, confirmWhenIndex, confirmAtEnd)
+	t.Setenv(confirmEnvVar, "no")
+	if again, err := confirmBeforeWait(context.Background(), true); err != nil || !again {
+		t.Errorf("confirmBeforeWait with --confirm-when end = %t, %v; want it left to the action", again, err)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Supported formats for the output printed on stdout.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// statusReport is the JSON object printed on stdout with --output json.
+type statusReport struct {
+	Action        string `json:"action"`
+	Status        string `json:"status"` // scheduled, executed, dry-run, notified, skipped, cancelled or failed.
+	ScheduledTime string `json:"scheduled_time,omitempty"`
+	DelaySeconds  int64  `json:"delay_seconds"`
+	Confirm       bool   `json:"confirm"`
+	DryRun        bool   `json:"dry_run"`
+	Message       string `json:"message,omitempty"`
+}
+
+// dryRunPlan is the JSON object printed by --dry-run --output json in place of
+// the status objects: everything the run would do, without doing any of it.
+type dryRunPlan struct {
+	Action        string                 `json:"action"`
+	Status        string                 `json:"status"` // Always dry-run.
+	Command       []string               `json:"command"`
+	ScheduledTime string                 `json:"scheduled_time,omitempty"`
+	DelaySeconds  int64                  `json:"delay_seconds"`
+	Ready         bool                   `json:"ready"` // Whether every preflight check passed.
+	Preflight     []preflightResult      `json:"preflight"`
+	Options       map[string]interface{} `json:"options"` // Resolved value of every option, by long name.
+}
+
+func jsonOutput() bool {
+	// Report whether stdout carries JSON status objects instead of prose.
+	return *(appFlags[outputIndex].value.(*string)) == outputJSON
+}
+
+func newStatusReport(action string, status string) statusReport {
+	// Start a status report with the options that apply to every action.
+	return statusReport{
+		Action:  action,
+		Status:  status,
+		Confirm: confirmationRequired(),
+		DryRun:  *(appFlags[dryRunIndex].value.(*bool)),
+	}
+}
+
+func reportScheduled(action string, at time.Time) {
+	// Describe an action that will run at the given time.
+	report := newStatusReport(action, "scheduled")
+	report.ScheduledTime = at.Format(time.RFC3339)
+	report.DelaySeconds = int64(at.Sub(clock.Now()).Round(time.Second) / time.Second)
+	emitStatus(report)
+}
+
+func reportSkipped(action string, message string) {
+	// Describe an action that was not performed because a condition was not met.
+	report := newStatusReport(action, "skipped")
+	report.Message = message
+	emitStatus(report)
+}
+
+func reportResult(action string, err error) {
+	// Describe the outcome of running the action.
+	report := newStatusReport(action, "executed")
+	switch {
+	case errors.Is(err, errCancelled):
+		report.Status = "cancelled"
+	case err != nil:
+		report.Status = "failed"
+		report.Message = err.Error()
+	case report.DryRun:
+		report.Status = "dry-run"
+	}
+	emitStatus(report)
+}
+
+func printDryRunPlan(action string, ready bool, results []preflightResult) error {
+	// Print the plan of a dry run as a single JSON object.
+	argv, _, err := systemCommand(action)
+	if err != nil {
+		return err
+	}
+	now := scheduleNow()
+	plan := dryRunPlan{
+		Action:    action,
+		Status:    "dry-run",
+		Command:   argv,
+		Ready:     ready,
+		Preflight: results,
+		Options:   make(map[string]interface{}),
+	}
+	if delay := plannedWait(action, now); delay > 0 {
+		plan.ScheduledTime = now.Add(delay).Format(time.RFC3339)
+		plan.DelaySeconds = int64(delay.Round(time.Second) / time.Second)
+	}
+	for _, fd := range appFlags {
+		switch v := fd.value.(type) {
+		case *bool:
+			plan.Options[fd.longName] = *v
+		case *int:
+			plan.Options[fd.longName] = *v
+		case *string:
+			plan.Options[fd.longName] = *v
+		case *stringList:
+			plan.Options[fd.longName] = append([]string{}, *v...)
+		}
+	}
+
+	data, err := json.Marshal(plan)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+func emitStatus(report statusReport) {
+	// Print one status object per line, and nothing unless --output json is set.
+	if !jsonOutput() {
+		return
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		logger.Errorf("Failed to encode status: %v\n", err)
+		return
+	}
+	fmt.Println(string(data))
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// preparePersistence flushes dirty file system buffers to disk right before the
+// system command runs, so that a poweroff that cuts power abruptly loses as
+// little as possible. Only Linux is supported; the file systems are not frozen
+// or remounted read-only because the shutdown itself still needs to write to
+// them. A failure is reported but never stops the action.
+func preparePersistence(ctx context.Context, action string, dryRun bool) {
+	if !*(appFlags[syncIndex].value.(*bool)) {
+		return
+	}
+	if runtime.GOOS != "linux" {
+		logger.Infof("Ignoring --sync for %s: only supported on Linux.\n", action)
+		printf("Warning: --sync is only supported on Linux, ignoring it.\n")
+		return
+	}
+
+	if timeout := time.Duration(getFlagInt(commandTimeoutIndex)) * time.Second; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, "sync")
+	if dryRun {
+		printDryRun(cmd)
+		return
+	}
+
+	logVerbose("Flushing file system buffers before the " + action + ".")
+	start := time.Now()
+	if err := systemCommandRunner.Run(cmd); err != nil {
+		logger.Errorf("Failed to sync file systems: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Warning: failed to sync file systems: %v\n", err)
+		return
+	}
+	logger.Infof("Synced file systems in %s.\n", time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,55 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"log/syslog"
+	"os"
+	"syscall"
+	"time"
+)
+
+func isElevated() (bool, error) {
+	// Token elevation only exists on Windows.
+	return false, errors.New("elevation check is only supported on Windows")
+}
+
+func windowsUptime() (time.Duration, error) {
+	// GetTickCount64 only exists on Windows.
+	return 0, errors.New("GetTickCount64 is only available on Windows")
+}
+
+func windowsFreeMemory() (uint64, error) {
+	// GlobalMemoryStatusEx only exists on Windows.
+	return 0, errors.New("GlobalMemoryStatusEx is only available on Windows")
+}
+
+func openEventLog() (levelWriter, error) {
+	// The Event Log only exists on Windows.
+	return nil, errors.New("the event log is only available on Windows")
+}
+
+func openSyslog() (levelWriter, error) {
+	// Connect to the local syslog daemon, tagging entries with the program name.
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, appName)
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func lockFile(file *os.File) error {
+	// Take an exclusive advisory lock without waiting for it.
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return errLockHeld
+	}
+	return err
+}
+
+func detachedProcAttr() *syscall.SysProcAttr {
+	// Start the daemon in a new session so that it has no controlling terminal
+	// and is not sent SIGHUP when the user logs out.
+	return &syscall.SysProcAttr{Setsid: true}
+}
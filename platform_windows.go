@@ -0,0 +1,176 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// tokenElevation is the TOKEN_INFORMATION_CLASS value for TokenElevation.
+const tokenElevation = 20
+
+func isElevated() (bool, error) {
+	// Report whether the current process runs with an elevated (Administrator) token.
+	token, err := syscall.OpenCurrentProcessToken()
+	if err != nil {
+		return false, err
+	}
+	defer token.Close()
+
+	var elevation uint32
+	var returned uint32
+	err = syscall.GetTokenInformation(token, tokenElevation, (*byte)(unsafe.Pointer(&elevation)), uint32(unsafe.Sizeof(elevation)), &returned)
+	if err != nil {
+		return false, err
+	}
+	return elevation != 0, nil
+}
+
+func isTerminal(f *os.File) bool {
+	// Report whether the file is attached to a console; pipes, files and NUL
+	// have no console mode.
+	var mode uint32
+	return syscall.GetConsoleMode(syscall.Handle(f.Fd()), &mode) == nil
+}
+
+var procGetTickCount64 = syscall.NewLazyDLL("kernel32.dll").NewProc("GetTickCount64")
+
+func windowsUptime() (time.Duration, error) {
+	// GetTickCount64 returns the milliseconds elapsed since the system started.
+	if err := procGetTickCount64.Find(); err != nil {
+		return 0, err
+	}
+	ticks, _, _ := procGetTickCount64.Call()
+	return time.Duration(ticks) * time.Millisecond, nil
+}
+
+// memoryStatusEx is the MEMORYSTATUSEX structure filled in by GlobalMemoryStatusEx.
+type memoryStatusEx struct {
+	length               uint32
+	memoryLoad           uint32
+	totalPhys            uint64
+	availPhys            uint64
+	totalPageFile        uint64
+	availPageFile        uint64
+	totalVirtual         uint64
+	availVirtual         uint64
+	availExtendedVirtual uint64
+}
+
+var procGlobalMemoryStatusEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GlobalMemoryStatusEx")
+
+func windowsFreeMemory() (uint64, error) {
+	// GlobalMemoryStatusEx reports the physical memory available to processes.
+	if err := procGlobalMemoryStatusEx.Find(); err != nil {
+		return 0, err
+	}
+	status := memoryStatusEx{length: uint32(unsafe.Sizeof(memoryStatusEx{}))}
+	ok, _, callErr := procGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&status)))
+	if ok == 0 {
+		return 0, callErr
+	}
+	return status.availPhys, nil
+}
+
+func openSyslog() (levelWriter, error) {
+	// Windows has no syslog daemon.
+	return nil, errors.New("syslog is not available on Windows")
+}
+
+// Event types passed to ReportEventW.
+const (
+	eventLogError       = 0x0001
+	eventLogInformation = 0x0004
+)
+
+var (
+	procRegisterEventSourceW = syscall.NewLazyDLL("advapi32.dll").NewProc("RegisterEventSourceW")
+	procReportEventW         = syscall.NewLazyDLL("advapi32.dll").NewProc("ReportEventW")
+)
+
+// eventLogWriter writes entries to the Application log of the Windows Event Log.
+type eventLogWriter struct {
+	handle uintptr // Event source handle returned by RegisterEventSourceW.
+}
+
+func openEventLog() (levelWriter, error) {
+	// Open the event source named after the program in the Application log.
+	if err := procRegisterEventSourceW.Find(); err != nil {
+		return nil, err
+	}
+	name, err := syscall.UTF16PtrFromString(appName)
+	if err != nil {
+		return nil, err
+	}
+	handle, _, callErr := procRegisterEventSourceW.Call(0, uintptr(unsafe.Pointer(name)))
+	if handle == 0 {
+		return nil, fmt.Errorf("registering event source: %v", callErr)
+	}
+	return &eventLogWriter{handle: handle}, nil
+}
+
+// Info writes an informational event.
+func (w *eventLogWriter) Info(m string) error {
+	return w.report(eventLogInformation, m)
+}
+
+// Err writes an error event.
+func (w *eventLogWriter) Err(m string) error {
+	return w.report(eventLogError, m)
+}
+
+func (w *eventLogWriter) report(eventType uint16, m string) error {
+	// Report one event carrying the message as its only insertion string.
+	message, err := syscall.UTF16PtrFromString(strings.ReplaceAll(m, "\x00", ""))
+	if err != nil {
+		return err
+	}
+	strs := []*uint16{message}
+	ok, _, callErr := procReportEventW.Call(w.handle, uintptr(eventType), 0, 1, 0, 1, 0, uintptr(unsafe.Pointer(&strs[0])), 0)
+	if ok == 0 {
+		return callErr
+	}
+	return nil
+}
+
+// Flags passed to LockFileEx.
+const (
+	lockfileFailImmediately = 0x00000001
+	lockfileExclusiveLock   = 0x00000002
+)
+
+// errorLockViolation is the ERROR_LOCK_VIOLATION error code.
+const errorLockViolation syscall.Errno = 33
+
+var procLockFileEx = syscall.NewLazyDLL("kernel32.dll").NewProc("LockFileEx")
+
+func lockFile(file *os.File) error {
+	// Lock the first byte of the file exclusively without waiting for it.
+	if err := procLockFileEx.Find(); err != nil {
+		return err
+	}
+	var overlapped syscall.Overlapped
+	ok, _, callErr := procLockFileEx.Call(file.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(&overlapped)))
+	if ok == 0 {
+		if errors.Is(callErr, errorLockViolation) {
+			return errLockHeld
+		}
+		return callErr
+	}
+	return nil
+}
+
+// detachedProcess is the DETACHED_PROCESS process creation flag.
+const detachedProcess = 0x00000008
+
+func detachedProcAttr() *syscall.SysProcAttr {
+	// Start the daemon without a console and in its own process group, so that
+	// closing the console window or pressing Ctrl+C there does not stop it.
+	return &syscall.SysProcAttr{CreationFlags: detachedProcess | syscall.CREATE_NEW_PROCESS_GROUP, HideWindow: true}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"sysreboot/reboot"
+)
+
+// preflightResult is the outcome of one preflight check.
+type preflightResult struct {
+	Check  string `json:"check"`  // Name of the check, usually the flag it belongs to.
+	Passed bool   `json:"passed"` // Whether the check lets the action proceed.
+	Detail string `json:"detail"` // What was found.
+}
+
+func (r preflightResult) String() string {
+	// Format the result as a "PASS check: detail" or "FAIL check: detail" line.
+	status := "PASS"
+	if !r.Passed {
+		status = "FAIL"
+	}
+	return fmt.Sprintf("%s %s: %s", status, r.Check, r.Detail)
+}
+
+// runPreflight evaluates everything that would stop the action from being
+// performed, without performing it or notifying anyone: privileges, the
+// --if-required, --if-idle and --max-uptime conditions, the presence of the
+// system command and the validity of the schedule. It returns whether the
+// action could proceed along with the result of each check.
+func runPreflight(action string) (bool, []preflightResult) {
+	ok := true
+	var results []preflightResult
+	report := func(passed bool, check string, format string, args ...interface{}) {
+		if !passed {
+			ok = false
+		}
+		results = append(results, preflightResult{Check: check, Passed: passed, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	if !needsPrivileges(action) {
+		report(true, "privileges", "none required to %s", action)
+	} else if sufficient, err := hasSufficientPrivileges(); err != nil {
+		report(false, "privileges", "cannot be determined: %v", err)
+	} else if sufficient {
+		report(true, "privileges", "sufficient to %s", action)
+	} else {
+		report(false, "privileges", "insufficient to %s; %s", action, privilegeHint())
+	}
+
+	force := *(appFlags[forceIndex].value.(*bool))
+	_, overridden := commandOverrides[action]
+	switch {
+	case !isContainer():
+		report(true, "container", "not detected")
+	case overridden:
+		report(true, "container", "detected, using the configured %s%s", action, commandOverrideSuffix)
+	case force:
+		report(true, "container", "detected, skipped by --force")
+	default:
+		report(false, "container", "detected; configure %s%s or use --force", action, commandOverrideSuffix)
+	}
+	if *(appFlags[ifRequiredIndex].value.(*bool)) {
+		switch {
+		case force:
+			report(true, "if-required", "skipped by --force")
+		case rebootRequired():
+			report(true, "if-required", "a reboot is required")
+		default:
+			report(false, "if-required", "no reboot required")
+		}
+	}
+
+	if *(appFlags[ifIdleIndex].value.(*bool)) {
+		if force {
+			report(true, "if-idle", "skipped by --force")
+		} else if sessions, err := activeSessions(); err != nil {
+			report(false, "if-idle", "%v", err)
+		} else if len(sessions) > 0 {
+			report(false, "if-idle", "active sessions: %s", strings.Join(sessions, ", "))
+		} else {
+			report(true, "if-idle", "no active sessions")
+		}
+	}
+
+	if inhibitorsApply(action) {
+		if holders, err := activeInhibitors(); err != nil {
+			report(true, "inhibitors", "not checked: %v", err)
+		} else if len(holders) > 0 {
+			report(false, "inhibitors", "blocked by %s", strings.Join(holders, ", "))
+		} else {
+			report(true, "inhibitors", "none blocking shutdown")
+		}
+	}
+
+	if minUptime := *(appFlags[maxUptimeIndex].value.(*string)); minUptime != "" {
+		threshold, err := parseDurationWithDays(minUptime)
+		if err != nil {
+			report(false, "max-uptime", "invalid --max-uptime: %v", err)
+		} else if force {
+			report(true, "max-uptime", "skipped by --force")
+		} else if up, err := uptime(); err != nil {
+			report(false, "max-uptime", "%v", err)
+		} else {
+			report(up >= threshold, "max-uptime", "uptime %s, threshold %s", up.Round(time.Second), minUptime)
+		}
+	}
+
+	if maxLoad := *(appFlags[maxLoadIndex].value.(*string)); maxLoad != "" {
+		if limit, err := strconv.ParseFloat(maxLoad, 64); err != nil || limit < 0 {
+			report(false, "max-load", "invalid --max-load %q", maxLoad)
+		} else if force {
+			report(true, "max-load", "skipped by --force")
+		} else if ok, detail, err := checkMaxLoad(); err != nil {
+			report(true, "max-load", "not checked: %v", err)
+		} else {
+			report(ok, "max-load", "%s", detail)
+		}
+	}
+	if getFlagInt(minFreeMemIndex) > 0 {
+		if force {
+			report(true, "min-free-mem", "skipped by --force")
+		} else if ok, detail, err := checkMinFreeMem(); err != nil {
+			report(true, "min-free-mem", "not checked: %v", err)
+		} else {
+			report(ok, "min-free-mem", "%s", detail)
+		}
+	}
+
+	if bin := *(appFlags[shutdownBinIndex].value.(*string)); bin != "" {
+		if _, err := exec.LookPath(bin); err != nil {
+			report(false, "shutdown-bin", "%v", err)
+		}
+	}
+	if kexecRequested(action) {
+		if _, err := kexecCommand(); err != nil {
+			report(true, "kexec", "falling back to a full reboot: %v", err)
+		} else {
+			report(true, "kexec", "kernel loaded")
+		}
+	}
+	if err := checkSystemCommand(action); err != nil {
+		report(false, "command", "%v", err)
+	} else {
+		argv, _, _ := systemCommand(action)
+		report(true, "command", "%s", shellJoin(argv))
+	}
+
+	now := scheduleNow()
+	if timeStr := *(appFlags[timeIndex].value.(*string)); timeStr != "" {
+		if at, err := reboot.ParseTime(*(appFlags[dateIndex].value.(*string)), timeStr, now); err != nil {
+			report(false, "time", "%v", err)
+		} else {
+			report(true, "time", "%s scheduled at %s", action, at.Format("2006-01-02 15:04"))
+		}
+	} else if *(appFlags[dateIndex].value.(*string)) != "" {
+		report(false, "time", "--date requires --time in HH:MM format")
+	}
+	for _, index := range []int{waitIndex, jitterIndex} {
+		if value := *(appFlags[index].value.(*string)); value != "" {
+			if _, err := parseDelay(value); err != nil {
+				report(false, appFlags[index].longName, "%v", err)
+			}
+		}
+	}
+	if wakeAt := *(appFlags[wakeAtIndex].value.(*string)); wakeAt != "" {
+		if _, err := parseScheduleTime(wakeAt, now); err != nil {
+			report(false, "wake-at", "%v", err)
+		}
+	}
+	return ok, results
+}
@@ -0,0 +1,114 @@
+package reboot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// ErrHaltUnsupported reports that Windows has no way to halt without powering off.
+var ErrHaltUnsupported = errors.New("halt is not supported on Windows; use --poweroff instead")
+
+// DefaultCommand returns the built-in command line performing the action on
+// this OS. The result is nil if this OS has no way to perform the action.
+func DefaultCommand(action string) ([]string, error) {
+	return CommandFor(runtime.GOOS, action)
+}
+
+// CommandFor returns the built-in command line performing the action on the
+// OS named like runtime.GOOS, so that the commands of every OS can be checked
+// from any of them. The result is nil if that OS has no way to perform the action.
+func CommandFor(goos string, action string) ([]string, error) {
+	switch goos {
+	case "linux":
+		return []string{"systemctl", action}, nil
+	case "windows":
+		if action == "reboot" {
+			return []string{"shutdown", "/r", "/t", "0"}, nil
+		} else if action == "poweroff" {
+			return []string{"shutdown", "/s", "/t", "0"}, nil
+		} else if action == "halt" {
+			return nil, ErrHaltUnsupported
+		} else if action == "suspend" {
+			// Sleeps, or hibernates instead when hibernation is enabled.
+			return []string{"rundll32.exe", "powrprof.dll,SetSuspendState", "0,1,0"}, nil
+		} else if action == "hibernate" {
+			return []string{"shutdown", "/h"}, nil
+		}
+	case "darwin":
+		// Hibernation is a pmset hibernatemode setting rather than a command, so
+		// only suspend is offered.
+		if action == "reboot" {
+			return []string{"sudo", "shutdown", "-r", "now"}, nil
+		} else if action == "poweroff" {
+			return []string{"sudo", "shutdown", "-h", "now"}, nil
+		} else if action == "halt" {
+			return []string{"sudo", "halt"}, nil
+		} else if action == "suspend" {
+			return []string{"pmset", "sleepnow"}, nil
+		}
+	case "freebsd", "openbsd", "netbsd":
+		if action == "reboot" {
+			return []string{"sudo", "shutdown", "-r", "now"}, nil
+		} else if action == "poweroff" {
+			return []string{"sudo", "shutdown", "-p", "now"}, nil
+		} else if action == "halt" {
+			return []string{"sudo", "halt"}, nil
+		} else if action == "suspend" && goos != "netbsd" {
+			return []string{"sudo", "zzz"}, nil
+		} else if action == "hibernate" && goos == "openbsd" {
+			return []string{"sudo", "ZZZ"}, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported action or OS: %s on %s", action, goos)
+	}
+	return nil, nil
+}
+
+// Execute runs the command performing the action and waits for it to finish.
+// The command runs in its own process group, so that anything it started is
+// killed along with it when ctx is cancelled or opts.Timeout expires. Failures
+// are reported as *ActionError.
+func Execute(ctx context.Context, opts Options) error {
+	argv := opts.Command
+	if argv == nil {
+		var err error
+		if argv, err = DefaultCommand(opts.Action); err != nil {
+			return newActionError(opts.Action, StageCommand, err)
+		}
+	}
+	// Not every OS knows every action; never run a command that was not chosen.
+	if argv == nil {
+		return newActionError(opts.Action, StageCommand, errors.New("unsupported action"))
+	}
+
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd)
+	}
+
+	runner := opts.Runner
+	if runner == nil {
+		runner = ExecRunner{}
+	}
+	if err := runner.Run(cmd); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return newActionError(opts.Action, StageTimeout, fmt.Errorf("%s did not finish within %s", argv[0], opts.Timeout))
+		}
+		return newActionError(opts.Action, StageExecute, err)
+	}
+	return nil
+}
+
+func newActionError(action string, stage string, err error) *ActionError {
+	// Attribute an error to a stage of the action on this OS.
+	return &ActionError{Action: action, OS: runtime.GOOS, Stage: stage, Err: err}
+}
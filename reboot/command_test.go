@@ -0,0 +1,80 @@
+package reboot
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+func TestCommandFor(t *testing.T) {
+	tests := []struct {
+		goos    string
+		action  string
+		want    []string
+		wantErr error
+	}{
+		{"linux", "reboot", []string{"systemctl", "reboot"}, nil},
+		{"linux", "poweroff", []string{"systemctl", "poweroff"}, nil},
+		{"linux", "halt", []string{"systemctl", "halt"}, nil},
+		{"windows", "reboot", []string{"shutdown", "/r", "/t", "0"}, nil},
+		{"windows", "poweroff", []string{"shutdown", "/s", "/t", "0"}, nil},
+		{"windows", "halt", nil, ErrHaltUnsupported},
+		{"darwin", "reboot", []string{"sudo", "shutdown", "-r", "now"}, nil},
+		{"darwin", "poweroff", []string{"sudo", "shutdown", "-h", "now"}, nil},
+		{"darwin", "halt", []string{"sudo", "halt"}, nil},
+	}
+	for _, tt := range tests {
+		got, err := CommandFor(tt.goos, tt.action)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("CommandFor(%q, %q) error = %v, want %v", tt.goos, tt.action, err, tt.wantErr)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("CommandFor(%q, %q) = %q, want %q", tt.goos, tt.action, got, tt.want)
+		}
+	}
+}
+
+func TestCommandForUnsupported(t *testing.T) {
+	if got, err := CommandFor("darwin", "hibernate"); got != nil || err != nil {
+		t.Errorf("CommandFor(darwin, hibernate) = %q, %v; want nil, nil", got, err)
+	}
+	if _, err := CommandFor("plan9", "reboot"); err == nil {
+		t.Error("CommandFor(plan9, reboot) succeeded, want an error")
+	}
+}
+
+// recordingRunner records the commands it is given instead of starting them.
+type recordingRunner struct {
+	commands [][]string
+	err      error
+}
+
+func (r *recordingRunner) Run(cmd *exec.Cmd) error {
+	r.commands = append(r.commands, cmd.Args)
+	return r.err
+}
+
+func TestExecuteRunsCommand(t *testing.T) {
+	runner := &recordingRunner{}
+	argv := []string{"systemctl", "reboot"}
+	if err := Execute(context.Background(), Options{Action: "reboot", Command: argv, Runner: runner}); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if want := [][]string{argv}; !reflect.DeepEqual(runner.commands, want) {
+		t.Errorf("ran %q, want %q", runner.commands, want)
+	}
+}
+
+func TestExecuteReportsFailure(t *testing.T) {
+	runner := &recordingRunner{err: errors.New("exit status 1")}
+	err := Execute(context.Background(), Options{Action: "poweroff", Command: []string{"systemctl", "poweroff"}, Runner: runner})
+	var ae *ActionError
+	if !errors.As(err, &ae) || ae.Stage != StageExecute || ae.Action != "poweroff" {
+		t.Fatalf("Execute error = %v, want an ActionError at stage %s", err, StageExecute)
+	}
+	if !errors.Is(err, runner.err) {
+		t.Errorf("Execute error does not wrap %v", runner.err)
+	}
+}
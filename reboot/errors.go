@@ -0,0 +1,35 @@
+package reboot
+
+import "fmt"
+
+// Stages of an action reported by ActionError.
+const (
+	StageSchedule = "schedule" // Working out when the action is due.
+	StageCommand  = "command"  // Choosing the system command.
+	StageExecute  = "execute"  // Running the system command.
+	StageTimeout  = "timeout"  // The system command exceeded its timeout.
+)
+
+// ActionError describes the failure of one stage of scheduling or performing
+// an action. The underlying error is available through errors.Unwrap.
+type ActionError struct {
+	Action string // Action that failed.
+	OS     string // Operating system the action was attempted on.
+	Stage  string // Stage that failed, such as StageSchedule or StageExecute.
+	Err    error  // What went wrong.
+}
+
+func (e *ActionError) Error() string {
+	switch e.Stage {
+	case StageSchedule:
+		return fmt.Sprintf("cannot schedule %s: %v", e.Action, e.Err)
+	case StageCommand:
+		return fmt.Sprintf("cannot %s on %s: %v", e.Action, e.OS, e.Err)
+	default:
+		return fmt.Sprintf("failed to execute %s: %v", e.Action, e.Err)
+	}
+}
+
+func (e *ActionError) Unwrap() error {
+	return e.Err
+}
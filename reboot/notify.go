@@ -0,0 +1,96 @@
+package reboot
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"unicode"
+)
+
+// MaxMessageLength is the number of characters of a message broadcast to
+// terminals; SanitizeMessage truncates longer ones.
+const MaxMessageLength = 1000
+
+// ErrBroadcastUnsupported reports that an OS has no command writing to the
+// terminals of every logged-in user.
+var ErrBroadcastUnsupported = errors.New("broadcasting messages is not supported on this OS")
+
+// WallCommand returns the command line writing the message to every
+// logged-in user on the OS named like runtime.GOOS: wall(1) on Unix-like
+// systems and msg.exe on Windows, which closes its pop-up after a minute. The
+// message is always the last argument. The result is nil if that OS has no
+// such command.
+func WallCommand(goos string, message string) []string {
+	switch goos {
+	case "linux", "darwin", "freebsd", "openbsd", "netbsd":
+		return []string{"wall", message}
+	case "windows":
+		return []string{"msg", "*", "/TIME:60", message}
+	}
+	return nil
+}
+
+// NotifyCommand returns the command line showing the message as a desktop
+// notification with the given title on the OS named like runtime.GOOS:
+// notify-send on Linux and osascript on macOS. The result is nil if that OS
+// has no such command.
+func NotifyCommand(goos string, title string, message string) []string {
+	switch goos {
+	case "linux":
+		return []string{"notify-send", title, message}
+	case "darwin":
+		return []string{"osascript", "-e", fmt.Sprintf("display notification %s with title %s", appleScriptQuote(message), appleScriptQuote(title))}
+	}
+	return nil
+}
+
+func appleScriptQuote(s string) string {
+	// Quote a string literal for use in an AppleScript expression.
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// SanitizeMessage makes a message safe to write to other users' terminals: it
+// drops ANSI escape sequences and control characters other than newline and
+// tab, replaces invalid UTF-8, and truncates messages longer than
+// MaxMessageLength characters with a trailing "...".
+func SanitizeMessage(message string) string {
+	var b strings.Builder
+	runes := []rune(strings.ToValidUTF8(message, "?"))
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\x1b':
+			// Skip a CSI sequence (ESC [ parameters final) along with the escape.
+			if i+1 < len(runes) && runes[i+1] == '[' {
+				for i += 2; i < len(runes) && (runes[i] < 0x40 || runes[i] > 0x7e); i++ {
+				}
+			}
+		case r == '\n' || r == '\t':
+			b.WriteRune(r)
+		case unicode.IsControl(r):
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	clean := []rune(b.String())
+	if len(clean) > MaxMessageLength {
+		return string(clean[:MaxMessageLength-3]) + "..."
+	}
+	return string(clean)
+}
+
+// Broadcast sanitizes the message and writes it to every logged-in user with
+// the WallCommand of this OS, run by runner; a nil runner starts it directly.
+func Broadcast(message string, runner Runner) error {
+	argv := WallCommand(runtime.GOOS, SanitizeMessage(message))
+	if argv == nil {
+		return ErrBroadcastUnsupported
+	}
+	if runner == nil {
+		runner = ExecRunner{}
+	}
+	return runner.Run(exec.Command(argv[0], argv[1:]...))
+}
@@ -0,0 +1,109 @@
+package reboot
+
+import (
+	"errors"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeMessage(t *testing.T) {
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{"Rebooting now", "Rebooting now"},
+		{"line one\nline two", "line one\nline two"},
+		{"col\tumn", "col\tumn"},
+		{"carriage\rreturn", "carriagereturn"},
+		{"\x1b[31mred\x1b[0m alert", "red alert"},
+		{"\x1b[2J\x1b[Hcleared", "cleared"},
+		{"bare\x1b escape", "bare escape"},
+		{"bell\a and nul\x00", "bell and nul"},
+		{"bad \xff byte", "bad ? byte"},
+	}
+	for _, tt := range tests {
+		if got := SanitizeMessage(tt.message); got != tt.want {
+			t.Errorf("SanitizeMessage(%q) = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeMessageTruncates(t *testing.T) {
+	got := []rune(SanitizeMessage(strings.Repeat("é", MaxMessageLength+10)))
+	if len(got) != MaxMessageLength || !strings.HasSuffix(string(got), "...") {
+		t.Errorf("SanitizeMessage kept %d characters ending in %q, want %d ending in \"...\"", len(got), string(got[len(got)-3:]), MaxMessageLength)
+	}
+	if again := SanitizeMessage(string(got)); again != string(got) {
+		t.Error("SanitizeMessage changed an already sanitized message")
+	}
+}
+
+func TestWallCommand(t *testing.T) {
+	message := `Rebooting in 5m0s; "save" your work`
+	tests := []struct {
+		goos string
+		want []string
+	}{
+		{"linux", []string{"wall", message}},
+		{"darwin", []string{"wall", message}},
+		{"freebsd", []string{"wall", message}},
+		{"openbsd", []string{"wall", message}},
+		{"netbsd", []string{"wall", message}},
+		{"windows", []string{"msg", "*", "/TIME:60", message}},
+		{"plan9", nil},
+	}
+	for _, tt := range tests {
+		if got := WallCommand(tt.goos, message); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("WallCommand(%q) = %q, want %q", tt.goos, got, tt.want)
+		}
+	}
+}
+
+func TestNotifyCommand(t *testing.T) {
+	tests := []struct {
+		goos string
+		want []string
+	}{
+		{"linux", []string{"notify-send", "sysreboot", `Say "bye"`}},
+		{"darwin", []string{"osascript", "-e", `display notification "Say \"bye\"" with title "sysreboot"`}},
+		{"windows", nil},
+	}
+	for _, tt := range tests {
+		if got := NotifyCommand(tt.goos, "sysreboot", `Say "bye"`); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NotifyCommand(%q) = %q, want %q", tt.goos, got, tt.want)
+		}
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	want := WallCommand(runtime.GOOS, "red alert")
+	runner := &recordingRunner{}
+	err := Broadcast("\x1b[31mred\x1b[0m alert", runner)
+	if want == nil {
+		if !errors.Is(err, ErrBroadcastUnsupported) {
+			t.Errorf("Broadcast error = %v, want %v", err, ErrBroadcastUnsupported)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("Broadcast: %v", err)
+	}
+	if !reflect.DeepEqual(runner.commands, [][]string{want}) {
+		t.Errorf("ran %q, want %q", runner.commands, [][]string{want})
+	}
+}
+
+func TestParseAction(t *testing.T) {
+	for name, want := range map[string]string{"reboot": "reboot", "poweroff": "poweroff", "shutdown": "poweroff", "hibernate": "hibernate"} {
+		if got, err := ParseAction(name); got != want || err != nil {
+			t.Errorf("ParseAction(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	for _, name := range []string{"", "restart", "Reboot"} {
+		if _, err := ParseAction(name); err == nil {
+			t.Errorf("ParseAction(%q) succeeded, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package reboot
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	// Start the command in a new process group led by the command itself.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	// Kill the command together with every process it started.
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package reboot
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	// Start the command in a new process group so console signals do not reach us.
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	// Windows has no process group kill; terminate the command itself.
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,67 @@
+// Package reboot schedules and performs power actions (reboot, poweroff, halt,
+// suspend and hibernate) with the commands native to each OS, and warns the
+// logged-in users beforehand. It holds the parts of the sysreboot command that
+// do not depend on its flags, config file or logging, so that other Go
+// programs can embed them: naming the action, working out when it is due,
+// pairing warning messages with checkpoints, broadcasting them and running the
+// action's command. The waiting itself, confirmation prompts, hooks and
+// webhooks stay in the command.
+package reboot
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Actions lists the actions that can be performed.
+var Actions = []string{"reboot", "poweroff", "halt", "suspend", "hibernate"}
+
+// IsAction reports whether name is one of Actions.
+func IsAction(name string) bool {
+	for _, action := range Actions {
+		if name == action {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseAction returns the action named by name: one of Actions, or shutdown,
+// which stands for poweroff.
+func ParseAction(name string) (string, error) {
+	switch {
+	case IsAction(name):
+		return name, nil
+	case name == "shutdown":
+		return "poweroff", nil
+	}
+	return "", fmt.Errorf("unknown action %q (expected %s)", name, strings.Join(Actions, ", "))
+}
+
+// Runner runs external commands, so that actions can be exercised without
+// rebooting the machine.
+type Runner interface {
+	Run(cmd *exec.Cmd) error
+}
+
+// ExecRunner is the Runner that actually starts the command.
+type ExecRunner struct{}
+
+// Run starts the command and waits for it to finish.
+func (ExecRunner) Run(cmd *exec.Cmd) error {
+	return cmd.Run()
+}
+
+// Options describes an action to schedule or perform.
+type Options struct {
+	Action  string        // Action to perform, one of Actions.
+	Date    string        // Optional YYYY-MM-DD date of the action; requires Time.
+	Time    string        // HH:MM time of day or an offset such as +30m; empty uses Delay.
+	Delay   time.Duration // How long after Now the action is due when Time is empty.
+	Now     time.Time     // Reference time for Date, Time and Delay; zero means the current time.
+	Command []string      // Command line performing the action; nil uses DefaultCommand.
+	Timeout time.Duration // How long the command may run before it is killed; zero waits indefinitely.
+	Runner  Runner        // Runs the command; nil starts it directly.
+}
@@ -0,0 +1,108 @@
+package reboot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schedule returns the moment the action described by opts is due: Date and
+// Time when Time is set, and Delay after Now otherwise. Date and Time are
+// interpreted in the location of Now.
+func Schedule(opts Options) (time.Time, error) {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if opts.Date == "" && opts.Time == "" {
+		return now.Add(opts.Delay), nil
+	}
+	at, err := ParseTime(opts.Date, opts.Time, now)
+	if err != nil {
+		return time.Time{}, newActionError(opts.Action, StageSchedule, err)
+	}
+	return at, nil
+}
+
+// ParseTime returns the moment described by an optional YYYY-MM-DD date and a
+// time. Without a date the time is either a relative offset ("+30m") or an
+// HH:MM time within the next 24 hours. With a date the time must be HH:MM, and
+// the combined moment must lie in the future.
+func ParseTime(dateStr string, timeStr string, now time.Time) (time.Time, error) {
+	if dateStr != "" {
+		if timeStr == "" || strings.HasPrefix(timeStr, "+") {
+			return time.Time{}, fmt.Errorf("--date requires --time in HH:MM format")
+		}
+		target, err := time.ParseInLocation("2006-01-02 15:04", dateStr+" "+timeStr, now.Location())
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date or time format: %v", err)
+		}
+		if !target.After(now) {
+			return time.Time{}, fmt.Errorf("scheduled time %s is in the past", target.Format("2006-01-02 15:04"))
+		}
+		return target, nil
+	}
+
+	if strings.HasPrefix(timeStr, "+") {
+		offset, err := time.ParseDuration(timeStr[1:])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time format: %v", err)
+		}
+		if offset < 0 {
+			return time.Time{}, fmt.Errorf("invalid time format: negative offset %q", timeStr)
+		}
+		return now.Add(offset), nil
+	}
+
+	timeOfDay, err := time.Parse("15:04", timeStr)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time format: %v", err)
+	}
+
+	// Use today's occurrence of the time, or tomorrow's if it has already passed.
+	// Tomorrow is built with time.Date rather than by adding 24 hours, so that
+	// the wall-clock time is kept across a daylight saving time change. A time
+	// skipped by the change, such as 02:30 when clocks spring forward from 02:00
+	// to 03:00, is normalized by time.Date to the moment after the gap.
+	target := time.Date(now.Year(), now.Month(), now.Day(), timeOfDay.Hour(), timeOfDay.Minute(), 0, 0, now.Location())
+	if target.Before(now) {
+		target = time.Date(now.Year(), now.Month(), now.Day()+1, timeOfDay.Hour(), timeOfDay.Minute(), 0, 0, now.Location())
+	}
+	return target, nil
+}
+
+// Warning is a broadcast sent some time before an action is due.
+type Warning struct {
+	Before  time.Duration // How long before the action the warning goes out.
+	Message string        // Message to send; a %s stands for the time remaining.
+}
+
+// CheckpointsWithin returns the checkpoints, given as durations before the
+// action, that fall within a wait of window, in their order.
+func CheckpointsWithin(checkpoints []time.Duration, window time.Duration) []time.Duration {
+	var within []time.Duration
+	for _, checkpoint := range checkpoints {
+		if checkpoint < window {
+			within = append(within, checkpoint)
+		}
+	}
+	return within
+}
+
+// Warnings pairs the messages in order with the checkpoints that fall within
+// a wait of window, reusing the last message for the remaining checkpoints.
+// Messages beyond the number of checkpoints are not sent.
+func Warnings(checkpoints []time.Duration, window time.Duration, messages []string) []Warning {
+	if len(messages) == 0 {
+		return nil
+	}
+	var warnings []Warning
+	for i, checkpoint := range CheckpointsWithin(checkpoints, window) {
+		message := messages[len(messages)-1]
+		if i < len(messages) {
+			message = messages[i]
+		}
+		warnings = append(warnings, Warning{Before: checkpoint, Message: message})
+	}
+	return warnings
+}
@@ -0,0 +1,117 @@
+package reboot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	_ "time/tzdata" // The DST tests need Europe/Berlin on every machine.
+)
+
+func TestParseTimeOffsets(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		timeStr string
+		want    time.Duration
+	}{
+		{"+45m", 45 * time.Minute},
+		{"+1h30m", 90 * time.Minute},
+		{"+0s", 0},
+	}
+	for _, tt := range tests {
+		got, err := ParseTime("", tt.timeStr, now)
+		if err != nil {
+			t.Errorf("ParseTime(%q): %v", tt.timeStr, err)
+			continue
+		}
+		if got.Sub(now) != tt.want {
+			t.Errorf("ParseTime(%q) = now + %s, want now + %s", tt.timeStr, got.Sub(now), tt.want)
+		}
+	}
+}
+
+func TestParseTimeRejectsMalformedTimes(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, timeStr := range []string{"+abc", "+", "+-5m", "25:00", "noon"} {
+		if got, err := ParseTime("", timeStr, now); err == nil {
+			t.Errorf("ParseTime(%q) = %s, want an error", timeStr, got)
+		}
+	}
+}
+
+func TestParseTimeOfDay(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		timeStr string
+		want    time.Time
+	}{
+		{"14:30", time.Date(2024, 5, 1, 14, 30, 0, 0, time.UTC)},
+		{"09:15", time.Date(2024, 5, 2, 9, 15, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := ParseTime("", tt.timeStr, now)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("ParseTime(%q) = %s, %v; want %s", tt.timeStr, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseTimeKeepsWallClockAcrossDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		now     time.Time
+		timeStr string
+		want    time.Time
+	}{
+		// Clocks spring forward from 02:00 to 03:00 on 31 March 2024.
+		{"spring forward", time.Date(2024, 3, 30, 23, 0, 0, 0, berlin), "22:00", time.Date(2024, 3, 31, 22, 0, 0, 0, berlin)},
+		// Clocks fall back from 03:00 to 02:00 on 27 October 2024.
+		{"fall back", time.Date(2024, 10, 26, 23, 0, 0, 0, berlin), "22:00", time.Date(2024, 10, 27, 22, 0, 0, 0, berlin)},
+		// 02:30 does not exist on 31 March 2024 and becomes 03:30.
+		{"skipped time", time.Date(2024, 3, 31, 1, 0, 0, 0, berlin), "02:30", time.Date(2024, 3, 31, 3, 30, 0, 0, berlin)},
+	}
+	for _, tt := range tests {
+		got, err := ParseTime("", tt.timeStr, tt.now)
+		if err != nil {
+			t.Errorf("%s: ParseTime(%q): %v", tt.name, tt.timeStr, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("%s: ParseTime(%q) = %s, want %s", tt.name, tt.timeStr, got, tt.want)
+		}
+		if wall := got.Format("15:04"); tt.name != "skipped time" && wall != tt.timeStr {
+			t.Errorf("%s: ParseTime(%q) is at %s local time", tt.name, tt.timeStr, wall)
+		}
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	checkpoints := []time.Duration{time.Hour, 10 * time.Minute, 5 * time.Minute, time.Minute}
+	tests := []struct {
+		name     string
+		window   time.Duration
+		messages []string
+		want     []Warning
+	}{
+		{"no messages", time.Hour, nil, nil},
+		{"one message", 15 * time.Minute, []string{"m"}, []Warning{
+			{10 * time.Minute, "m"}, {5 * time.Minute, "m"}, {time.Minute, "m"},
+		}},
+		// The hour is outside the window, so the first message goes with 10m.
+		{"paired within window", 30 * time.Minute, []string{"first", "second"}, []Warning{
+			{10 * time.Minute, "first"}, {5 * time.Minute, "second"}, {time.Minute, "second"},
+		}},
+		{"extra messages", 2 * time.Minute, []string{"first", "second"}, []Warning{
+			{time.Minute, "first"},
+		}},
+		{"empty window", 0, []string{"m"}, nil},
+	}
+	for _, tt := range tests {
+		if got := Warnings(checkpoints, tt.window, tt.messages); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Warnings = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"sysreboot/reboot"
+)
+
+// Supported values of --repeat.
+const (
+	repeatDaily  = "daily"
+	repeatWeekly = "weekly"
+)
+
+// systemdUnitDir is where the timer and service units of a recurring schedule are installed.
+const systemdUnitDir = "/etc/systemd/system"
+
+// recurringSchedule describes when a recurring action runs.
+type recurringSchedule struct {
+	repeat  string       // repeatDaily or repeatWeekly.
+	hour    int          // Hour of the day, 0-23.
+	minute  int          // Minute of the hour, 0-59.
+	weekday time.Weekday // Day of the week for weekly schedules.
+}
+
+// repeatSkipFlags lists the flags that only describe the schedule being
+// installed, or would wait for an answer nobody can give, and are therefore not
+// passed on to the scheduled invocation.
+var repeatSkipFlags = []int{cancelWindowIndex, confirmIndex, confirmPhraseIndex, dateIndex, delayIndex, dryRunIndex, repeatIndex, timeIndex, useAtIndex, useSystemdShutdownIndex, waitIndex, warnAtIndex}
+
+func parseRecurringSchedule(repeat string, dateStr string, timeStr string, now time.Time) (recurringSchedule, error) {
+	// Work out the recurring schedule from --repeat, --time and the optional
+	// --date, which picks the weekday of a weekly schedule. Without a date the
+	// weekday of the next occurrence of the time is used.
+	if repeat != repeatDaily && repeat != repeatWeekly {
+		return recurringSchedule{}, fmt.Errorf("invalid --repeat %q (expected %s or %s)", repeat, repeatDaily, repeatWeekly)
+	}
+	if timeStr == "" || strings.HasPrefix(timeStr, "+") {
+		return recurringSchedule{}, fmt.Errorf("--repeat requires --time in HH:MM format")
+	}
+	first, err := reboot.ParseTime(dateStr, timeStr, now)
+	if err != nil {
+		return recurringSchedule{}, err
+	}
+	// The supervisors run schedules in local time.
+	first = first.Local()
+	return recurringSchedule{repeat: repeat, hour: first.Hour(), minute: first.Minute(), weekday: first.Weekday()}, nil
+}
+
+func (s recurringSchedule) String() string {
+	// Describe the schedule for messages, e.g. "daily at 02:00" or "weekly on Tuesday at 02:00".
+	if s.repeat == repeatWeekly {
+		return fmt.Sprintf("weekly on %s at %02d:%02d", s.weekday, s.hour, s.minute)
+	}
+	return fmt.Sprintf("daily at %02d:%02d", s.hour, s.minute)
+}
+
+func recurringCommand(action string) ([]string, error) {
+	// Build the command line the supervisor runs on every occurrence: this
+	// executable with the action and the other options given on the command line.
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("cannot determine the sysreboot executable: %v", err)
+	}
+	args := []string{exe, "--action", action}
+	return append(args, forwardedFlags(repeatSkipFlags)...), nil
+}
+
+// actionFlagIndexes lists the flags that select the action.
+var actionFlagIndexes = []int{actionIndex, haltIndex, hibernateIndex, poweroffIndex, rebootIndex, shutdownIndex, suspendIndex}
+
+func forwardedFlags(skipFlags []int) []string {
+	// Repeat the flags given on the command line, except the action flags and
+	// those in skipFlags, for another invocation of sysreboot. The --category
+	// policy is resolved here: the flags it seeded are passed on instead, so
+	// it cannot turn on prompts in a job that has no terminal.
+	skip := map[string]bool{appFlags[categoryIndex].longName: true}
+	for _, index := range append(append([]int(nil), skipFlags...), actionFlagIndexes...) {
+		skip[appFlags[index].longName] = true
+	}
+
+	var args []string
+	for _, fd := range appFlags {
+		if skip[fd.longName] || !flagGiven(fd) && !categorySeeded[fd.longName] {
+			continue
+		}
+		if list, ok := fd.value.(*stringList); ok {
+			for _, value := range *list {
+				args = append(args, "--"+fd.longName+"="+value)
+			}
+			continue
+		}
+		args = append(args, "--"+fd.longName+"="+flagValueString(fd))
+	}
+	return args
+}
+
+func flagGiven(fd flagData) bool {
+	// Report whether the flag was given on the command line in either form.
+	given := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == fd.longName || f.Name == fd.shortName {
+			given = true
+		}
+	})
+	return given
+}
+
+// installRecurringSchedule makes the supervisor of this OS run the action on
+// every occurrence of the schedule: a systemd timer on Linux machines booted
+// with systemd, a crontab entry on other Unix systems and a scheduled task on
+// Windows. The schedule survives the reboots it causes.
+func installRecurringSchedule(action string, schedule recurringSchedule, dryRun bool) error {
+	argv, err := recurringCommand(action)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case runtime.GOOS == "windows":
+		err = installScheduledTask(action, schedule, argv, dryRun)
+	case systemdAvailable():
+		err = installSystemdTimer(action, schedule, argv, dryRun)
+	default:
+		err = installCrontabEntry(action, schedule, argv, dryRun)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !dryRun {
+		logger.Infof("Installed recurring %s %s.\n", action, schedule)
+		printf("Recurring %s installed %s.\n", action, schedule)
+	}
+	return nil
+}
+
+func recurringName(action string) string {
+	// Name the timer, crontab entry or task of a recurring action.
+	return appName + "-" + action
+}
+
+func installSystemdTimer(action string, schedule recurringSchedule, argv []string, dryRun bool) error {
+	// Write a oneshot service running the action and a timer triggering it, then
+	// enable the timer.
+	name := recurringName(action)
+	calendar := fmt.Sprintf("*-*-* %02d:%02d:00", schedule.hour, schedule.minute)
+	if schedule.repeat == repeatWeekly {
+		calendar = schedule.weekday.String()[:3] + " " + calendar
+	}
+
+	units := []struct {
+		path    string
+		content string
+	}{
+		{
+			filepath.Join(systemdUnitDir, name+".service"),
+			fmt.Sprintf("[Unit]\nDescription=%s recurring %s\n\n[Service]\nType=oneshot\nExecStart=%s\n", appName, action, systemdQuoteArgs(argv)),
+		},
+		{
+			filepath.Join(systemdUnitDir, name+".timer"),
+			fmt.Sprintf("[Unit]\nDescription=Run %s %s %s\n\n[Timer]\nOnCalendar=%s\n\n[Install]\nWantedBy=timers.target\n", appName, action, schedule, calendar),
+		},
+	}
+	for _, unit := range units {
+		if dryRun {
+			printDryRunFile(unit.path, unit.content)
+			continue
+		}
+		if err := os.WriteFile(unit.path, []byte(unit.content), 0644); err != nil {
+			return fmt.Errorf("writing %s: %v", unit.path, err)
+		}
+	}
+
+	for _, args := range [][]string{{"daemon-reload"}, {"enable", "--now", name + ".timer"}} {
+		if err := runSetupCommand(exec.Command("systemctl", args...), dryRun); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func systemdQuoteArgs(args []string) string {
+	// Quote a command line for ExecStart=, where the specifier character % must be doubled.
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		arg = strings.ReplaceAll(arg, "%", "%%")
+		if arg != "" && !strings.ContainsAny(arg, " \t\"'\\;$") {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+	}
+	return strings.Join(quoted, " ")
+}
+
+func installCrontabEntry(action string, schedule recurringSchedule, argv []string, dryRun bool) error {
+	// Replace any previous entry for the action in the user's crontab.
+	marker := "# " + recurringName(action)
+	weekday := "*"
+	if schedule.repeat == repeatWeekly {
+		weekday = fmt.Sprint(int(schedule.weekday))
+	}
+	// An unescaped % ends the command in a crontab line.
+	entry := fmt.Sprintf("%d %d * * %s %s %s", schedule.minute, schedule.hour, weekday, strings.ReplaceAll(shellJoin(argv), "%", `\%`), marker)
+
+	if dryRun {
+		line := fmt.Sprintf("Dry run (%s): would add to crontab: %s", runtime.GOOS, entry)
+		logger.Info(line)
+		printLine(line)
+		return nil
+	}
+
+	// crontab -l fails when the user has no crontab yet, which is fine.
+	current, _ := exec.Command("crontab", "-l").Output()
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(string(current), "\n"), "\n") {
+		if line != "" && !strings.HasSuffix(line, marker) {
+			lines = append(lines, line)
+		}
+	}
+	lines = append(lines, entry)
+
+	cmd := exec.Command("crontab", "-")
+	cmd.Stdin = strings.NewReader(strings.Join(lines, "\n") + "\n")
+	return runSetupCommand(cmd, false)
+}
+
+func installScheduledTask(action string, schedule recurringSchedule, argv []string, dryRun bool) error {
+	// Create or replace a task running the action as SYSTEM.
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		if arg == "" || strings.ContainsAny(arg, " \t\"") {
+			arg = `"` + strings.ReplaceAll(arg, `"`, `\"`) + `"`
+		}
+		quoted[i] = arg
+	}
+
+	args := []string{"/Create", "/F", "/TN", recurringName(action), "/RU", "SYSTEM", "/TR", strings.Join(quoted, " "), "/ST", fmt.Sprintf("%02d:%02d", schedule.hour, schedule.minute)}
+	if schedule.repeat == repeatWeekly {
+		args = append(args, "/SC", "WEEKLY", "/D", strings.ToUpper(schedule.weekday.String()[:3]))
+	} else {
+		args = append(args, "/SC", "DAILY")
+	}
+	return runSetupCommand(exec.Command("schtasks", args...), dryRun)
+}
+
+func runSetupCommand(cmd *exec.Cmd, dryRun bool) error {
+	// Run a command that installs part of a schedule, reporting its output on failure.
+	if dryRun {
+		printDryRun(cmd)
+		return nil
+	}
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %v: %s", shellJoin(cmd.Args), err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+func printDryRunFile(path string, content string) {
+	// Report a file that would have been written without writing it.
+	line := fmt.Sprintf("Dry run (%s): would write %s:\n%s", runtime.GOOS, path, content)
+	logger.Info(line)
+	printLine(line)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"sysreboot/reboot"
+)
+
+// reloadSignals receives SIGHUP while a daemon waits, asking it to re-read the
+// config file. Outside a daemon nothing is sent, and a hangup ends the wait as
+// it always has.
+var reloadSignals = make(chan os.Signal, 1)
+
+// reloadLock is held while a reload changes the flags, and by the warning
+// timers while they broadcast, so that a warning never sees half a reload.
+var reloadLock sync.Mutex
+
+// reloadableFlags lists the options a reload takes from the config file: how
+// users are warned and how the action is approached. The time the action is
+// due is not among them; cancel the action and schedule it again to move it.
+var reloadableFlags = []int{graceIndex, messageIndex, notifyIndex, notifyUserIndex, reasonIndex, tagMessageIndex, wallIndex, warnAtIndex}
+
+func reloadConfig() {
+	// Re-read the config file and apply the reloadable options that were not
+	// given on the command line or seeded by --category, rearming the pending
+	// warnings. A file that does not parse, or asks for more messages than
+	// warning checkpoints, leaves everything as it was.
+	settings, _, _, err := readConfigFile(getConfigFilePath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Errorf("Not reloading config file: %v\n", err)
+		return
+	}
+
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	saved := make(map[int]interface{})
+	var changes []string
+	for _, index := range reloadableFlags {
+		fd := appFlags[index]
+		if flagGiven(fd) || categorySeeded[fd.longName] || (index == messageIndex && flagGiven(appFlags[messageFileIndex])) {
+			continue
+		}
+		saved[index] = copyFlagValue(fd)
+		before := flagValueString(fd)
+		resetFlag(fd)
+		for _, setting := range settings {
+			if setting.fd.longName == fd.longName {
+				assignFlagValue(fd, setting.value)
+			}
+		}
+		if after := flagValueString(fd); after != before {
+			changes = append(changes, fmt.Sprintf("--%s %q -> %q", fd.longName, before, after))
+		}
+	}
+
+	checkpoints, err := reloadedCheckpoints()
+	if err != nil {
+		restoreFlags(saved)
+		logger.Errorf("Not reloading config file: %v\n", err)
+		return
+	}
+	if !armedWarnings.deadline.IsZero() {
+		armWarnings(armedWarnings.deadline, armedWarnings.window, checkpoints, composeMessages())
+	}
+	if len(changes) == 0 {
+		logger.Info("Config file reloaded, nothing changed.")
+		return
+	}
+	logger.Infof("Config file reloaded: %s\n", strings.Join(changes, ", "))
+}
+
+func reloadedCheckpoints() ([]time.Duration, error) {
+	// Validate the reloaded messages and return the warning checkpoints they
+	// go with: those within the wait that is under way, if any. Unlike at
+	// startup, checkpoints that have already passed are simply skipped.
+	if err := checkMessageTemplate(); err != nil {
+		return nil, err
+	}
+	checkpoints := warningCheckpoints
+	if warnAt := *(appFlags[warnAtIndex].value.(*string)); warnAt != "" {
+		custom, err := parseWarnAt(warnAt)
+		if err != nil {
+			return nil, err
+		}
+		checkpoints = custom
+	}
+	if armedWarnings.window > 0 {
+		checkpoints = reboot.CheckpointsWithin(checkpoints, armedWarnings.window)
+		if messages := composeMessages(); len(messages) > 1 && len(messages) > len(checkpoints) {
+			return nil, fmt.Errorf("more --message values (%d) than warning checkpoints within the wait (%d)", len(messages), len(checkpoints))
+		}
+	}
+	return checkpoints, nil
+}
+
+func resetFlag(fd flagData) {
+	// Put a flag back to its built-in default.
+	switch v := fd.value.(type) {
+	case *bool:
+		*v = fd.defaultVal.(bool)
+	case *int:
+		*v = fd.defaultVal.(int)
+	case *string:
+		*v = fd.defaultVal.(string)
+	case *stringList:
+		*v = nil
+	}
+}
+
+func copyFlagValue(fd flagData) interface{} {
+	// Take a copy of a flag's current value for restoreFlags.
+	switch v := fd.value.(type) {
+	case *bool:
+		return *v
+	case *int:
+		return *v
+	case *string:
+		return *v
+	case *stringList:
+		return append(stringList(nil), *v...)
+	}
+	return nil
+}
+
+func restoreFlags(saved map[int]interface{}) {
+	// Put back the values taken by copyFlagValue, by flag index.
+	for index, value := range saved {
+		switch v := appFlags[index].value.(type) {
+		case *bool:
+			*v = value.(bool)
+		case *int:
+			*v = value.(int)
+		case *string:
+			*v = value.(string)
+		case *stringList:
+			*v = value.(stringList)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// session is a logged-in user session as reported by who(1) or query user.
+type session struct {
+	user string        // Name of the logged-in user.
+	line string        // Terminal or session name.
+	idle time.Duration // Time since the last input on the session.
+}
+
+// activeSessions returns the logged-in sessions that count as active: every
+// session, or only those idle for less than --idle-threshold minutes when set.
+func activeSessions() ([]string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("query", "user")
+	default:
+		cmd = exec.Command("who", "-u")
+	}
+
+	output, err := cmd.Output()
+	if err != nil {
+		// query user exits 1 when nobody is logged on.
+		if exitErr, ok := err.(*exec.ExitError); ok && runtime.GOOS == "windows" && exitErr.ExitCode() == 1 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("listing sessions: %v", err)
+	}
+
+	threshold := time.Duration(getFlagInt(idleThresholdIndex)) * time.Minute
+	return filterActiveSessions(parseSessions(runtime.GOOS, string(output)), threshold), nil
+}
+
+func filterActiveSessions(sessions []session, threshold time.Duration) []string {
+	// Describe the sessions idle for less than threshold; a zero threshold keeps all.
+	var active []string
+	for _, s := range sessions {
+		if threshold > 0 && s.idle >= threshold {
+			continue
+		}
+		active = append(active, fmt.Sprintf("%s (%s)", s.user, s.line))
+	}
+	return active
+}
+
+func parseSessions(goos string, output string) []session {
+	// Parse `who -u` output, or `query user` output on Windows.
+	var sessions []session
+	for i, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		if goos == "windows" {
+			if i == 0 && strings.EqualFold(fields[0], "USERNAME") {
+				continue // Header line.
+			}
+			if s, ok := parseQueryUserLine(fields); ok {
+				sessions = append(sessions, s)
+			}
+			continue
+		}
+		sessions = append(sessions, parseWhoLine(fields))
+	}
+	return sessions
+}
+
+func parseWhoLine(fields []string) session {
+	// who -u prints NAME LINE TIME IDLE ..., where TIME spans several fields and
+	// ends with HH:MM, so IDLE is the field following the first clock time.
+	s := session{user: fields[0], line: fields[1]}
+	for i := 2; i < len(fields)-1; i++ {
+		if isClockTime(fields[i]) {
+			s.idle = parseWhoIdle(fields[i+1])
+			break
+		}
+	}
+	return s
+}
+
+func parseWhoIdle(field string) time.Duration {
+	// Convert a who -u IDLE column: "." (active), "old" (over a day) or HH:MM.
+	switch field {
+	case ".":
+		return 0
+	case "old":
+		return 24 * time.Hour
+	}
+	if isClockTime(field) {
+		hours, _ := strconv.Atoi(field[:len(field)-3])
+		minutes, _ := strconv.Atoi(field[len(field)-2:])
+		return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute
+	}
+	return 0
+}
+
+func isClockTime(field string) bool {
+	// Report whether the field looks like H:MM or HH:MM.
+	hours, minutes, found := strings.Cut(field, ":")
+	if !found || len(minutes) != 2 || hours == "" {
+		return false
+	}
+	_, errH := strconv.Atoi(hours)
+	_, errM := strconv.Atoi(minutes)
+	return errH == nil && errM == nil
+}
+
+func parseQueryUserLine(fields []string) (session, bool) {
+	// query user prints USERNAME [SESSIONNAME] ID STATE IDLE LOGON-TIME, where
+	// SESSIONNAME is blank for disconnected sessions.
+	for i := 1; i < len(fields)-1; i++ {
+		if fields[i] != "Active" && fields[i] != "Disc" {
+			continue
+		}
+		s := session{user: strings.TrimPrefix(fields[0], ">"), line: "disconnected"}
+		if i == 3 {
+			s.line = fields[1]
+		}
+		s.idle = parseQueryUserIdle(fields[i+1])
+		return s, true
+	}
+	return session{}, false
+}
+
+func parseQueryUserIdle(field string) time.Duration {
+	// Convert a query user IDLE TIME column: "none", ".", minutes, H:MM or D+H:MM.
+	if field == "none" || field == "." {
+		return 0
+	}
+	var idle time.Duration
+	if days, rest, found := strings.Cut(field, "+"); found {
+		n, _ := strconv.Atoi(days)
+		idle = time.Duration(n) * 24 * time.Hour
+		field = rest
+	}
+	if isClockTime(field) {
+		return idle + parseWhoIdle(field)
+	}
+	minutes, _ := strconv.Atoi(field)
+	return idle + time.Duration(minutes)*time.Minute
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSessionsWho(t *testing.T) {
+	// who -u as printed by GNU coreutils and by the BSDs and macOS.
+	output := `alice    pts/0        2024-05-01 09:12   .          1234 (10.0.0.5)
+bob      pts/1        2024-05-01 08:00 01:30        2345 (10.0.0.6)
+carol    tty1         2024-04-28 17:45  old         987
+dave     ttys000  May  1 09:12 00:07
+`
+	want := []session{
+		{user: "alice", line: "pts/0", idle: 0},
+		{user: "bob", line: "pts/1", idle: 90 * time.Minute},
+		{user: "carol", line: "tty1", idle: 24 * time.Hour},
+		{user: "dave", line: "ttys000", idle: 7 * time.Minute},
+	}
+	if got := parseSessions("linux", output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSessions = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseSessionsEmpty(t *testing.T) {
+	if got := parseSessions("linux", "\n"); len(got) != 0 {
+		t.Errorf("parseSessions of empty output = %+v, want none", got)
+	}
+}
+
+func TestParseSessionsQueryUser(t *testing.T) {
+	output := ` USERNAME              SESSIONNAME        ID  STATE   IDLE TIME  LOGON TIME
+>alice                 console             1  Active      none   5/1/2024 9:12 AM
+ bob                                       2  Disc        1+02:05  4/30/2024 7:00 AM
+ carol                 rdp-tcp#3           3  Active         12  5/1/2024 8:00 AM
+`
+	want := []session{
+		{user: "alice", line: "console", idle: 0},
+		{user: "bob", line: "disconnected", idle: 26*time.Hour + 5*time.Minute},
+		{user: "carol", line: "rdp-tcp#3", idle: 12 * time.Minute},
+	}
+	if got := parseSessions("windows", output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSessions = %+v, want %+v", got, want)
+	}
+}
+
+func TestFilterActiveSessions(t *testing.T) {
+	sessions := []session{
+		{user: "alice", line: "pts/0", idle: 0},
+		{user: "bob", line: "pts/1", idle: 90 * time.Minute},
+	}
+	if got, want := filterActiveSessions(sessions, time.Hour), []string{"alice (pts/0)"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("filterActiveSessions = %q, want %q", got, want)
+	}
+	if got := filterActiveSessions(sessions, 0); len(got) != 2 {
+		t.Errorf("filterActiveSessions without a threshold = %q, want both sessions", got)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// pendingState describes a delayed or scheduled action that is waiting to fire.
+type pendingState struct {
+	PID    int       `json:"pid"`    // Process ID of the waiting sysreboot instance.
+	Action string    `json:"action"` // Action that will be performed.
+	Time   time.Time `json:"time"`   // Moment the action is due.
+}
+
+// lastAction describes the most recent action sysreboot performed on this machine.
+type lastAction struct {
+	Time   time.Time `json:"time"`             // Moment the system command was run.
+	Action string    `json:"action"`           // Action that was performed.
+	Reason string    `json:"reason,omitempty"` // Value of --reason, if any.
+	User   string    `json:"user"`             // User who invoked sysreboot.
+}
+
+func getStateFilePath(pid int) string {
+	// Each waiting process has its own state file next to the log file.
+	return filepath.Join(getLogFileDirectory(), fmt.Sprintf("%s-%d.state", appName, pid))
+}
+
+func writePendingState(action string, at time.Time) error {
+	// Record the pending action so that a later --cancel or --list can find this process.
+	data, err := json.Marshal(pendingState{PID: os.Getpid(), Action: action, Time: at})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(getStateFilePath(os.Getpid()), data, 0644)
+}
+
+func readPendingStates() ([]pendingState, error) {
+	// Load every pending action recorded by waiting sysreboot processes, ordered
+	// by the time they are due. Unreadable state files are skipped.
+	paths, err := filepath.Glob(filepath.Join(getLogFileDirectory(), appName+"-*.state"))
+	if err != nil {
+		return nil, err
+	}
+
+	var states []pendingState
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var state pendingState
+		if err := json.Unmarshal(data, &state); err != nil {
+			logger.Errorf("Ignoring invalid state file %s: %v\n", path, err)
+			continue
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Time.Before(states[j].Time)
+	})
+	return states, nil
+}
+
+func removePendingState(pid int) {
+	// Remove a state file, ignoring the case where it is already gone.
+	if err := os.Remove(getStateFilePath(pid)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Errorf("Failed to remove state file: %v\n", err)
+	}
+}
+
+func livePendingStates() ([]pendingState, error) {
+	// Return the pending actions whose process is still running, pruning the
+	// state files left behind by processes that are gone.
+	states, err := readPendingStates()
+	if err != nil {
+		return nil, err
+	}
+
+	live := states[:0]
+	for _, state := range states {
+		if !processAlive(state.PID) {
+			logVerbose(fmt.Sprintf("Removing stale state file for PID %d.", state.PID))
+			removePendingState(state.PID)
+			continue
+		}
+		live = append(live, state)
+	}
+	return live, nil
+}
+
+func processAlive(pid int) bool {
+	// Report whether a process with the given PID is still running.
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// FindProcess opens a handle on Windows and fails for missing processes.
+		process.Release()
+		return true
+	}
+	// Signal 0 checks for existence; EPERM means it exists but belongs to someone else.
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// trackPendingAction records the pending action so that --cancel and --list can
+// find this process. The returned function removes the record once the wait is over.
+func trackPendingAction(action string, at time.Time) func() {
+	if err := writePendingState(action, at); err != nil {
+		logger.Errorf("Failed to write state file: %v\n", err)
+	}
+	return func() {
+		removePendingState(os.Getpid())
+		if runningAsDaemon() {
+			removePIDFile()
+		}
+	}
+}
+
+func listScheduled() error {
+	// Print a table of the pending actions of all running sysreboot processes.
+	states, err := livePendingStates()
+	if err != nil {
+		return err
+	}
+	jobs, err := pendingAtJobs()
+	if err != nil {
+		logger.Errorf("Cannot list at jobs: %v\n", err)
+	}
+	if len(states) == 0 && len(jobs) == 0 {
+		fmt.Println("No pending actions.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PID\tACTION\tSCHEDULED\tREMAINING")
+	row := func(pid string, action string, at time.Time) {
+		remaining := at.Sub(clock.Now()).Round(time.Second)
+		if remaining < 0 {
+			remaining = 0
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", pid, action, at.Format("2006-01-02 15:04:05"), remaining)
+	}
+	for _, state := range states {
+		row(fmt.Sprint(state.PID), state.Action, state.Time)
+	}
+	for _, job := range jobs {
+		row("at job "+job.Job, job.Action, job.Time)
+	}
+	return w.Flush()
+}
+
+// cancelPendingAction stops every running sysreboot process with a pending action.
+// On Unix-like systems the process receives SIGTERM and cleans up after itself
+// (see waitForAction). Windows has no equivalent signal, so the process is
+// terminated by PID and its state file is removed here instead. Actions handed
+// over to at with --use-at are removed from its queue with atrm.
+func cancelPendingAction() error {
+	states, err := livePendingStates()
+	if err != nil {
+		return err
+	}
+	cancelledJobs, failures := cancelAtJobs()
+	if len(states) == 0 && cancelledJobs == 0 && len(failures) == 0 {
+		return errors.New("no pending action found")
+	}
+
+	for _, state := range states {
+		process, err := os.FindProcess(state.PID)
+		if err == nil {
+			if runtime.GOOS == "windows" {
+				err = process.Kill()
+			} else {
+				err = process.Signal(syscall.SIGTERM)
+			}
+		}
+		removePendingState(state.PID)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s (PID %d): %v", state.Action, state.PID, err))
+			continue
+		}
+
+		logger.Infof("Cancelled pending %s scheduled at %s (PID %d).\n", state.Action, state.Time.Format("15:04"), state.PID)
+		printf("Cancelled pending %s scheduled at %s (PID %d).\n", state.Action, state.Time.Format("15:04"), state.PID)
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to cancel %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func getLastActionFilePath() string {
+	// The record of the last action lives next to the log file, like the pending states.
+	return filepath.Join(getLogFileDirectory(), appName+"-last.json")
+}
+
+func invokingUser() string {
+	// Name the user behind the action, looking through sudo to the real user.
+	if name := os.Getenv("SUDO_USER"); name != "" {
+		return name
+	}
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+	return "unknown"
+}
+
+func recordLastAction(action string, reason string, at time.Time) {
+	// Remember when, why and by whom the action was performed for a later --last.
+	// A failure is logged but never stands in the way of the action.
+	data, err := json.Marshal(lastAction{Time: at, Action: action, Reason: reason, User: invokingUser()})
+	if err == nil {
+		err = os.WriteFile(getLastActionFilePath(), data, 0644)
+	}
+	if err != nil {
+		logger.Errorf("Failed to record last action: %v\n", err)
+	}
+}
+
+func printLastAction() error {
+	// Print the record written by recordLastAction, if sysreboot has ever run an action.
+	data, err := os.ReadFile(getLastActionFilePath())
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("No action has been performed by %s yet.\n", appName)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var last lastAction
+	if err := json.Unmarshal(data, &last); err != nil {
+		return fmt.Errorf("invalid last action file %s: %v", getLastActionFilePath(), err)
+	}
+
+	if jsonOutput() {
+		fmt.Println(string(data))
+		return nil
+	}
+	fmt.Printf("Last action: %s at %s by %s\n", last.Action, last.Time.Format("2006-01-02 15:04:05"), last.User)
+	if last.Reason != "" {
+		fmt.Printf("Reason: %s\n", last.Reason)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// waitStatus is written to --status-file on every tick of a wait, so that a
+// monitoring agent can show what is coming without parsing the log:
+//
+//	{"action":"reboot","phase":"scheduled","remaining_seconds":120,"due":"2026-10-14T23:00:00+02:00","pid":4242,"updated":"2026-10-14T22:58:00+02:00"}
+type waitStatus struct {
+	Action           string `json:"action"`
+	Phase            string `json:"phase"` // scheduled, grace, final-countdown or cancel-window.
+	RemainingSeconds int64  `json:"remaining_seconds"`
+	Due              string `json:"due"`
+	PID              int    `json:"pid"`
+	Updated          string `json:"updated"`
+}
+
+// Phases of a wait as reported in the status file.
+const (
+	phaseScheduled      = "scheduled"
+	phaseGrace          = "grace"
+	phaseFinalCountdown = "final-countdown"
+	phaseCancelWindow   = "cancel-window"
+)
+
+// statusFileFailed is set once a write to the status file fails, so that the
+// error is logged once rather than on every tick.
+var statusFileFailed bool
+
+func writeStatusFile(action string, phase string, deadline time.Time, remaining time.Duration) {
+	// Replace the status file atomically by writing a temporary file in the
+	// same directory and renaming it over the old one, so that a reader never
+	// sees a partial update.
+	path := *(appFlags[statusFileIndex].value.(*string))
+	if path == "" {
+		return
+	}
+	data, err := json.Marshal(waitStatus{
+		Action:           action,
+		Phase:            phase,
+		RemainingSeconds: int64(remaining.Round(time.Second) / time.Second),
+		Due:              deadline.Format(time.RFC3339),
+		PID:              os.Getpid(),
+		Updated:          clock.Now().Format(time.RFC3339),
+	})
+	if err == nil {
+		err = replaceFile(path, data)
+	}
+	if err != nil && !statusFileFailed {
+		statusFileFailed = true
+		logger.Errorf("Failed to write status file: %v\n", err)
+	}
+}
+
+func replaceFile(path string, data []byte) error {
+	// Write data to path through a temporary file and a rename.
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func removeStatusFile() {
+	// Remove the status file once a wait is over, ignoring the case where it
+	// was never written.
+	path := *(appFlags[statusFileIndex].value.(*string))
+	if path == "" {
+		return
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Errorf("Failed to remove status file: %v\n", err)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func systemdAvailable() bool {
+	// systemd creates this directory early at boot; its presence is the
+	// documented way to detect that the system was booted with systemd.
+	if runtime.GOOS != "linux" {
+		return false
+	}
+	info, err := os.Stat("/run/systemd/system")
+	return err == nil && info.IsDir()
+}
+
+// systemdInProcessFlags lists the flags whose work is done by sysreboot itself,
+// during the wait or when the action runs. shutdown(8) only broadcasts its own
+// warnings and runs the default command, so with any of them changed from its
+// default the wait stays in-process.
+var systemdInProcessFlags = []int{abortFileIndex, cancelWindowIndex, commandTimeoutIndex, graceIndex, kexecIndex, notifyUserIndex, preHookIndex, retryIndex, shutdownBinIndex, statusFileIndex, syncIndex, wakeAtIndex, wallIndex, warnAtIndex, webhookIndex}
+
+func systemdInProcessOption(action string) string {
+	// Name the first option that shutdown(8) cannot honour, or return "" if it
+	// can take the action over.
+	for _, index := range systemdInProcessFlags {
+		if !flagIsDefault(appFlags[index]) {
+			return "--" + appFlags[index].longName
+		}
+	}
+	// The desktop notification is on by default, but shutdown(8) only walls,
+	// so it is only kept in-process when asked for on the command line.
+	if fd := appFlags[notifyIndex]; flagGiven(fd) && *(fd.value.(*bool)) {
+		return "--" + fd.longName
+	}
+	if len(composeMessages()) > 1 {
+		return "Repeating --message"
+	}
+	if _, ok := commandOverrides[action]; ok {
+		return "The " + action + commandOverrideSuffix + " setting"
+	}
+	return ""
+}
+
+func systemdShutdownArgs(action string, timeStr string, delay time.Duration, message string) ([]string, error) {
+	// Translate the action and its schedule into shutdown(8) arguments.
+	var args []string
+	switch action {
+	case "reboot":
+		args = append(args, "-r")
+	case "poweroff":
+		args = append(args, "-P")
+	case "halt":
+		args = append(args, "-H")
+	default:
+		return nil, fmt.Errorf("action %s cannot be scheduled with shutdown", action)
+	}
+
+	switch {
+	case timeStr != "" && !strings.HasPrefix(timeStr, "+"):
+		if _, err := time.Parse("15:04", timeStr); err != nil {
+			return nil, fmt.Errorf("invalid time format: %v", err)
+		}
+		args = append(args, timeStr)
+	case timeStr != "":
+		offset, err := parseScheduleTime(timeStr, clock.Now())
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "+"+strconv.Itoa(minutesCeil(offset)))
+	default:
+		args = append(args, "+"+strconv.Itoa(minutesCeil(delay)))
+	}
+
+	if message != "" {
+		args = append(args, message)
+	}
+	return args, nil
+}
+
+func minutesCeil(d time.Duration) int {
+	// shutdown(8) only understands whole minutes, so never fire early.
+	return int((d + time.Minute - 1) / time.Minute)
+}
+
+func scheduleWithSystemdShutdown(action string, timeStr string, delay time.Duration, message string, confirmation bool, dryRun bool) error {
+	// Hand the schedule over to shutdown(8) so that it survives this process exiting.
+	args, err := systemdShutdownArgs(action, timeStr, delay, message)
+	if err != nil {
+		return usageError{err}
+	}
+
+	// The action happens without us, so confirm before handing it over.
+	if confirmation && !confirmAction(context.Background(), getConfirmOptions()) {
+		printLine("Action cancelled.")
+		logger.Info("Action cancelled by user.")
+		return errCancelled
+	}
+
+	cmd := exec.Command("shutdown", args...)
+	if dryRun {
+		printDryRun(cmd)
+		return nil
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("shutdown %s failed: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+
+	logger.Infof("%s handed over to systemd shutdown (%s).\n", action, strings.Join(args, " "))
+	at := clock.Now().Add(delay)
+	if timeStr != "" {
+		if offset, err := parseScheduleTime(timeStr, clock.Now()); err == nil {
+			at = clock.Now().Add(offset)
+		}
+	}
+	logAudit(action, "scheduled for "+at.Format(time.RFC3339))
+	// Nothing of ours runs when shutdown(8) acts, so the action is recorded
+	// for --last and --report-boot now, with the time it is due.
+	reason := *(appFlags[reasonIndex].value.(*string))
+	recordLastAction(action, reason, at)
+	recordPendingBoot(action, reason)
+	reportScheduled(action, at)
+	printf("%s scheduled with systemd; cancel it with 'shutdown -c'.\n", action)
+	return nil
+}
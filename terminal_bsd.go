@@ -0,0 +1,8 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package main
+
+import "syscall"
+
+// ioctlReadTermios is the ioctl request that reads a terminal's settings.
+const ioctlReadTermios = syscall.TIOCGETA
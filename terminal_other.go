@@ -0,0 +1,15 @@
+//go:build !windows && !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package main
+
+import "os"
+
+func isTerminal(f *os.File) bool {
+	// Without a known tty ioctl, fall back to treating character devices as
+	// terminals.
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,29 @@
+//go:build testhooks
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"runtime"
+
+	"sysreboot/reboot"
+)
+
+// simulateFailure is set by --simulate-failure, which only exists in builds
+// made with the testhooks tag so that release binaries never carry it.
+var simulateFailure bool
+
+func init() {
+	flag.BoolVar(&simulateFailure, "simulate-failure", false, "Fail the action with a synthetic error instead of running it (testhooks builds only).")
+}
+
+func simulatedFailure(action string) error {
+	// Make the action fail without running anything, for exercising error
+	// handling, exit codes and monitoring.
+	if !simulateFailure {
+		return nil
+	}
+	logger.Errorf("Simulating failure of %s action.\n", action)
+	return &reboot.ActionError{Action: action, OS: runtime.GOOS, Stage: reboot.StageExecute, Err: errors.New("simulated failure")}
+}
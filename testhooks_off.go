@@ -0,0 +1,8 @@
+//go:build !testhooks
+
+package main
+
+func simulatedFailure(action string) error {
+	// Release builds have no --simulate-failure flag and never fail on purpose.
+	return nil
+}
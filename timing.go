@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timingPhases lists the phases of a run timed for --verbose, in the order
+// they are reported.
+var timingPhases = []string{"preflight", "confirmation", "wait", "notification", "hooks", "command"}
+
+// phaseTimings accumulates how long each phase of the run took. Warnings sent
+// by the timers of a wait are added from their own goroutines, so the time
+// they take counts towards both the wait and the notifications.
+var phaseTimings = struct {
+	sync.Mutex
+	start  time.Time
+	phases map[string]time.Duration
+}{phases: make(map[string]time.Duration)}
+
+func startPhaseTimings() {
+	// Mark the start of the run, where the preflight phase begins.
+	phaseTimings.Lock()
+	defer phaseTimings.Unlock()
+	phaseTimings.start = clock.Now()
+}
+
+func timePhase(name string) func() {
+	// Start timing a phase; the returned function adds the elapsed time to it.
+	start := clock.Now()
+	return func() {
+		addPhaseTime(name, clock.Now().Sub(start))
+	}
+}
+
+func addPhaseTime(name string, d time.Duration) {
+	phaseTimings.Lock()
+	defer phaseTimings.Unlock()
+	phaseTimings.phases[name] += d
+}
+
+func endPreflight() {
+	// Close the preflight phase, which runs from startup until the action is
+	// set up to wait or run.
+	phaseTimings.Lock()
+	start := phaseTimings.start
+	phaseTimings.Unlock()
+	addPhaseTime("preflight", clock.Now().Sub(start))
+}
+
+func logPhaseTimings(label string) {
+	// Log how long each phase took with --verbose, leaving out the phases the
+	// run did not go through.
+	if !*(appFlags[verboseIndex].value.(*bool)) {
+		return
+	}
+	phaseTimings.Lock()
+	defer phaseTimings.Unlock()
+	var parts []string
+	for _, name := range timingPhases {
+		if d, ok := phaseTimings.phases[name]; ok {
+			parts = append(parts, fmt.Sprintf("%s %s", name, d.Round(time.Millisecond)))
+		}
+	}
+	logger.Infof("Timing (%s): %s; total %s\n", label, strings.Join(parts, ", "), clock.Now().Sub(phaseTimings.start).Round(time.Millisecond))
+}
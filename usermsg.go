@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"sysreboot/reboot"
+)
+
+func userTTYs(sessions []session, user string) []string {
+	// List the terminals the user is logged in on, each once, in the order
+	// who(1) reports them.
+	var ttys []string
+	seen := make(map[string]bool)
+	for _, s := range sessions {
+		if s.user != user || seen[s.line] {
+			continue
+		}
+		seen[s.line] = true
+		ttys = append(ttys, s.line)
+	}
+	return ttys
+}
+
+// sendUserMessage writes the message to one logged-in user instead of
+// everyone: with write(1) on each of the user's terminals, resolved through
+// who(1), or with msg.exe on Windows, which reaches every session of the user.
+// A user who is not logged in is not an error, since there is nobody to warn.
+func sendUserMessage(user string, message string, dryRun bool) error {
+	message = reboot.SanitizeMessage(message)
+	if runtime.GOOS == "windows" {
+		return runUserMessage(exec.Command("msg", user, "/TIME:60", message), "", dryRun)
+	}
+
+	output, err := exec.Command("who").Output()
+	if err != nil {
+		return fmt.Errorf("listing sessions: %v", err)
+	}
+	ttys := userTTYs(parseSessions(runtime.GOOS, string(output)), user)
+	if len(ttys) == 0 {
+		logVerbose(fmt.Sprintf("%s is not logged in, not sending the message.", user))
+		return nil
+	}
+	var failures []string
+	for _, tty := range ttys {
+		// write(1) reads the message from stdin and ends it at EOF.
+		if err := runUserMessage(exec.Command("write", user, tty), message+"\n", dryRun); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", tty, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("writing to %s failed on %s", user, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func runUserMessage(cmd *exec.Cmd, stdin string, dryRun bool) error {
+	// Run a command delivering a message to one user, feeding it stdin if any.
+	if dryRun {
+		printDryRun(cmd)
+		return nil
+	}
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUserTTYs(t *testing.T) {
+	// Plain who(1) output, as read by sendUserMessage.
+	output := `alice    pts/0        2024-05-01 09:12 (10.0.0.5)
+bob      pts/1        2024-05-01 08:00 (10.0.0.6)
+alice    pts/2        2024-05-01 10:30 (10.0.0.7)
+alice    pts/0        2024-05-01 09:12 (10.0.0.5)
+alicia   pts/3        2024-05-01 11:00
+`
+	sessions := parseSessions("linux", output)
+	tests := []struct {
+		user string
+		want []string
+	}{
+		{"alice", []string{"pts/0", "pts/2"}},
+		{"bob", []string{"pts/1"}},
+		{"carol", nil},
+	}
+	for _, tt := range tests {
+		if got := userTTYs(sessions, tt.user); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("userTTYs(%q) = %q, want %q", tt.user, got, tt.want)
+		}
+	}
+}
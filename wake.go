@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// rtcWakeAlarmFile is the sysfs interface for the RTC wake alarm on Linux.
+const rtcWakeAlarmFile = "/sys/class/rtc/rtc0/wakealarm"
+
+func scheduleWake(at time.Time) error {
+	// Program the real-time clock to power the machine back on at the given time.
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("RTC wake alarms are not supported on %s", runtime.GOOS)
+	}
+
+	// The kernel refuses a new alarm while one is set, so clear it first.
+	if err := os.WriteFile(rtcWakeAlarmFile, []byte("0"), 0644); err != nil {
+		return fmt.Errorf("clearing RTC wake alarm: %v", err)
+	}
+	if err := os.WriteFile(rtcWakeAlarmFile, []byte(strconv.FormatInt(at.Unix(), 10)), 0644); err != nil {
+		return fmt.Errorf("setting RTC wake alarm: %v", err)
+	}
+	return nil
+}
+
+func prepareWake(action string, wakeAt string, dryRun bool) {
+	// Arrange for the machine to come back after a poweroff. Failing to do so is
+	// reported but does not stop the action.
+	if wakeAt == "" {
+		return
+	}
+	if action != "poweroff" {
+		logger.Infof("Ignoring --wake-at for %s action.\n", action)
+		printf("Warning: --wake-at only applies to poweroff, ignoring it.\n")
+		return
+	}
+
+	now := scheduleNow()
+	d, err := parseScheduleTime(wakeAt, now)
+	if err != nil {
+		logger.Errorf("Invalid wake time: %v\n", err)
+		return
+	}
+	at := now.Add(d)
+
+	if dryRun {
+		line := fmt.Sprintf("Dry run: would set RTC wake alarm for %s", at.Format("2006-01-02 15:04"))
+		logger.Info(line)
+		printLine(line)
+		return
+	}
+	if err := scheduleWake(at); err != nil {
+		logger.Errorf("Skipping wake alarm: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Warning: skipping wake alarm: %v\n", err)
+		return
+	}
+	logger.Infof("RTC wake alarm set for %s.\n", at.Format("2006-01-02 15:04"))
+	printf("Machine will wake at %s.\n", at.Format("2006-01-02 15:04"))
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// webhookTimeout bounds how long a slow endpoint can delay the action.
+const webhookTimeout = 10 * time.Second
+
+// webhookPayload is the JSON body posted to the webhook before the action runs.
+type webhookPayload struct {
+	Hostname  string `json:"hostname"`
+	Action    string `json:"action"`
+	Reason    string `json:"reason,omitempty"`
+	Timestamp string `json:"timestamp"`
+}
+
+func sendWebhook(url string, action string, reason string, dryRun bool) error {
+	// Notify the webhook endpoint that the action is about to be executed.
+	err := postWebhook(url, webhookPayload{
+		Hostname:  getHostname(),
+		Action:    action,
+		Reason:    reason,
+		Timestamp: time.Now().Format(time.RFC3339),
+	}, dryRun)
+	if err == nil && !dryRun {
+		logger.Infof("Webhook %s notified of %s.\n", url, action)
+	}
+	return err
+}
+
+func postWebhook(url string, payload interface{}, dryRun bool) error {
+	// POST the payload as JSON, treating any status other than 2xx as a failure.
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		line := fmt.Sprintf("Dry run: would POST %s to %s", body, url)
+		logger.Info(line)
+		printLine(line)
+		return nil
+	}
+
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}